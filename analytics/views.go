@@ -0,0 +1,218 @@
+// Package analytics records post views. Views are deduplicated per visitor
+// and buffered in memory, then flushed to the database in batches so the
+// read path doesn't hit MySQL on every request.
+package analytics
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DirectReferrer is the host recorded for views without a usable referrer.
+const DirectReferrer = "direct"
+
+var botPattern = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|curl|wget|python-requests|go-http-client|headless|preview|scanner|monitor`)
+
+type dayKey struct {
+	postID uint
+	day    string
+}
+
+type referrerKey struct {
+	postID uint
+	day    string
+	host   string
+}
+
+type recorder struct {
+	mu        sync.Mutex
+	window    time.Duration
+	seen      map[string]time.Time
+	views     map[dayKey]int64
+	referrers map[referrerKey]int64
+}
+
+var views = &recorder{
+	seen:      map[string]time.Time{},
+	views:     map[dayKey]int64{},
+	referrers: map[referrerKey]int64{},
+}
+
+var startOnce sync.Once
+
+// Start launches the background flusher. The dedup window and the flush
+// interval are read from VIEW_WINDOW_MINUTES (default 30) and
+// VIEW_FLUSH_SECONDS (default 10). Call Flush on shutdown to write the
+// views still buffered.
+func Start() {
+	startOnce.Do(func() {
+		views.window = time.Duration(tools.EnvInt("VIEW_WINDOW_MINUTES", 30)) * time.Minute
+		seconds := tools.EnvInt("VIEW_FLUSH_SECONDS", 10)
+		if seconds < 1 {
+			seconds = 10
+		}
+		interval := time.Duration(seconds) * time.Second
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := Flush(); err != nil {
+					log.Println("flushing post views:", err)
+				}
+			}
+		}()
+	})
+}
+
+// IsBot reports whether the user agent looks like a crawler or a script.
+func IsBot(userAgent string) bool {
+	return strings.TrimSpace(userAgent) == "" || botPattern.MatchString(userAgent)
+}
+
+// VisitorKey identifies a visitor: the user ID when logged in, otherwise a
+// hash of the client IP and user agent.
+func VisitorKey(userID, ip, userAgent string) string {
+	if userID != "" {
+		return "u:" + userID
+	}
+	sum := sha1.Sum([]byte(ip + "|" + userAgent))
+	return "a:" + hex.EncodeToString(sum[:])
+}
+
+// ReferrerHost reduces a Referer header to its host. Empty, malformed and
+// same-site referrers count as direct traffic.
+func ReferrerHost(referer, ownHost string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return DirectReferrer
+	}
+	host := strings.ToLower(strings.TrimPrefix(u.Hostname(), "www."))
+	own := strings.ToLower(strings.TrimPrefix(strings.Split(ownHost, ":")[0], "www."))
+	if host == "" || host == own {
+		return DirectReferrer
+	}
+	return host
+}
+
+// Record counts a view of the post unless the same visitor already viewed
+// it within the dedup window. It reports whether the view was counted.
+func Record(postID uint, visitor, referrerHost string) bool {
+	now := time.Now()
+	key := visitor + "#" + strconv.FormatUint(uint64(postID), 10)
+
+	views.mu.Lock()
+	defer views.mu.Unlock()
+	if last, ok := views.seen[key]; ok && now.Sub(last) < views.window {
+		return false
+	}
+	views.seen[key] = now
+
+	day := now.Format("2006-01-02")
+	views.views[dayKey{postID, day}]++
+	views.referrers[referrerKey{postID, day, referrerHost}]++
+	return true
+}
+
+// Flush writes the buffered counters to the database and forgets visitors
+// whose dedup window has passed. Counters that fail to be written are put
+// back into the buffer for the next flush.
+func Flush() error {
+	views.mu.Lock()
+	pendingViews, pendingReferrers := views.views, views.referrers
+	views.views = map[dayKey]int64{}
+	views.referrers = map[referrerKey]int64{}
+	now := time.Now()
+	for key, last := range views.seen {
+		if now.Sub(last) >= views.window {
+			delete(views.seen, key)
+		}
+	}
+	views.mu.Unlock()
+
+	if len(pendingViews) == 0 {
+		return nil
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for key, count := range pendingViews {
+			day, _ := time.Parse("2006-01-02", key.day)
+			stat := structures.PostDailyStat{PostID: key.postID, Day: day, Views: count}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "post_id"}, {Name: "day"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"views": gorm.Expr("views + ?", count)}),
+			}).Create(&stat).Error
+			if err != nil {
+				return err
+			}
+		}
+		for key, count := range pendingReferrers {
+			day, _ := time.Parse("2006-01-02", key.day)
+			stat := structures.PostReferrerStat{PostID: key.postID, Day: day, Host: key.host, Views: count}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "post_id"}, {Name: "day"}, {Name: "host"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{"views": gorm.Expr("views + ?", count)}),
+			}).Create(&stat).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		views.mu.Lock()
+		for key, count := range pendingViews {
+			views.views[key] += count
+		}
+		for key, count := range pendingReferrers {
+			views.referrers[key] += count
+		}
+		views.mu.Unlock()
+	}
+	return err
+}
+
+// Pending returns the buffered, not yet flushed views of a post so that
+// totals read from the database can include them.
+func Pending(postID uint) int64 {
+	views.mu.Lock()
+	defer views.mu.Unlock()
+	var total int64
+	for key, count := range views.views {
+		if key.postID == postID {
+			total += count
+		}
+	}
+	return total
+}
+
+// DeletePost drops the stored and buffered stats of a deleted post.
+func DeletePost(postID uint) {
+	views.mu.Lock()
+	for key := range views.views {
+		if key.postID == postID {
+			delete(views.views, key)
+		}
+	}
+	for key := range views.referrers {
+		if key.postID == postID {
+			delete(views.referrers, key)
+		}
+	}
+	views.mu.Unlock()
+
+	db.DB.Where("post_id = ?", postID).Delete(&structures.PostDailyStat{})
+	db.DB.Where("post_id = ?", postID).Delete(&structures.PostReferrerStat{})
+}
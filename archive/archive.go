@@ -0,0 +1,80 @@
+// Package archive exports blog content to a versioned JSON archive (or a zip
+// of Markdown files with front matter) and imports such archives back.
+package archive
+
+import (
+	"archive/zip"
+	"time"
+)
+
+// Version is the archive format version written by Export. Import accepts
+// archives up to this version.
+const Version = 1
+
+// mediaDir is the folder of zip archives holding the uploaded files the
+// posts use.
+const mediaDir = "media/"
+
+// Archive is the portable form of a site's or a user's content.
+type Archive struct {
+	Version    int       `json:"version"`
+	Origin     string    `json:"origin"`
+	ExportedAt time.Time `json:"exported_at"`
+	Scope      string    `json:"scope"`
+	Authors    []Author  `json:"authors"`
+	Tags       []Tag     `json:"tags"`
+	Posts      []Post    `json:"posts"`
+	Comments   []Comment `json:"comments"`
+
+	// media holds the files of a zip archive under media/, by file name.
+	media map[string]*zip.File
+}
+
+// Author identifies the writer of posts and comments. Email is used to map
+// authors onto existing accounts on import.
+type Author struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// MediaRef points at an uploaded file. Files themselves are not part of the
+// archive.
+type MediaRef struct {
+	FileName     string `json:"file_name"`
+	OriginalName string `json:"original_name"`
+	URL          string `json:"url"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+type Post struct {
+	ID         uint       `json:"id"`
+	AuthorID   string     `json:"author_id"`
+	Title      string     `json:"title"`
+	Slug       string     `json:"slug"`
+	Body       string     `json:"body"`
+	Visibility string     `json:"visibility"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Tags       []string   `json:"tags"`
+	Cover      *MediaRef  `json:"cover,omitempty"`
+	Media      []MediaRef `json:"media,omitempty"`
+}
+
+// Comment is a comment on an exported post. ParentID is the comment it
+// replies to, if any.
+type Comment struct {
+	ID        uint      `json:"id"`
+	PostID    uint      `json:"post_id"`
+	ParentID  *uint     `json:"parent_id,omitempty"`
+	AuthorID  string    `json:"author_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
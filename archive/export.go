@@ -0,0 +1,258 @@
+package archive
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+// Export builds an archive of the posts of one user, or of the whole site
+// when userID is empty. Only approved posts and comments are exported.
+// Comments on the exported posts are included whoever wrote them, along
+// with their authors.
+func Export(origin, userID string) (*Archive, error) {
+	a := &Archive{
+		Version:    Version,
+		Origin:     origin,
+		ExportedAt: time.Now().UTC(),
+		Scope:      "site",
+		Authors:    []Author{},
+		Tags:       []Tag{},
+		Posts:      []Post{},
+		Comments:   []Comment{},
+	}
+
+	// Posts held as spam or rejected stay behind, like held comments
+	query := db.DB.Preload("Tags").Where("status = ?", structures.PostApproved).Order("id")
+	if userID != "" {
+		a.Scope = "user:" + userID
+		query = query.Where("user_id = ?", userID)
+	}
+	var posts []structures.Blog
+	if err := query.Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	authorIDs := map[string]bool{}
+	tags := map[string]Tag{}
+	postIDs := make([]uint, 0, len(posts))
+	for _, post := range posts {
+		entry := Post{
+			ID:         post.Id,
+			AuthorID:   post.UserID,
+			Title:      post.Title,
+			Slug:       structures.Slugify(post.Title),
+			Body:       post.Desc,
+			Visibility: post.Visibility,
+			CreatedAt:  post.CreatedAt,
+			UpdatedAt:  post.UpdatedAt,
+			Tags:       []string{},
+		}
+		for _, tag := range post.Tags {
+			entry.Tags = append(entry.Tags, tag.Name)
+			tags[tag.Slug] = Tag{Name: tag.Name, Slug: tag.Slug}
+		}
+		entry.Cover, entry.Media = postMedia(post)
+		a.Posts = append(a.Posts, entry)
+		authorIDs[post.UserID] = true
+		postIDs = append(postIDs, post.Id)
+	}
+
+	if len(postIDs) > 0 {
+		var comments []structures.Comment
+		if err := db.DB.Where("post_id IN ? AND deleted = ? AND status = ?", postIDs, false, structures.CommentApproved).Order("id").Find(&comments).Error; err != nil {
+			return nil, err
+		}
+		for _, comment := range comments {
+			a.Comments = append(a.Comments, Comment{
+				ID:        comment.ID,
+				PostID:    comment.PostID,
+				ParentID:  comment.ParentID,
+				AuthorID:  comment.UserID,
+				Content:   comment.Content,
+				CreatedAt: comment.DateTime,
+			})
+			authorIDs[comment.UserID] = true
+		}
+	}
+
+	ids := make([]string, 0, len(authorIDs))
+	for id := range authorIDs {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		var users []structures.User
+		if err := db.DB.Where("id IN ?", ids).Order("id").Find(&users).Error; err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			author := Author{
+				ID:        strconv.Itoa(int(user.Id)),
+				FirstName: user.FirstName,
+				LastName:  user.LastName,
+				Email:     user.Email,
+			}
+			// A user's own export must not leak the emails of commenters
+			if userID != "" && author.ID != userID {
+				author.Email = ""
+			}
+			a.Authors = append(a.Authors, author)
+		}
+	}
+
+	for _, tag := range tags {
+		a.Tags = append(a.Tags, tag)
+	}
+	return a, nil
+}
+
+// postMedia returns references to the cover and inline media of a post.
+func postMedia(post structures.Blog) (*MediaRef, []MediaRef) {
+	var cover *MediaRef
+	if post.CoverMediaID != nil {
+		var media structures.Media
+		if err := db.DB.Where("id = ?", *post.CoverMediaID).First(&media).Error; err == nil {
+			ref := mediaRef(media)
+			cover = &ref
+		}
+	}
+
+	var media []structures.Media
+	db.DB.Joins("JOIN post_media ON post_media.media_id = media.id").
+		Where("post_media.post_id = ?", post.Id).
+		Order("post_media.position").
+		Find(&media)
+	var refs []MediaRef
+	for _, m := range media {
+		refs = append(refs, mediaRef(m))
+	}
+	return cover, refs
+}
+
+func mediaRef(m structures.Media) MediaRef {
+	return MediaRef{
+		FileName:     m.FileName,
+		OriginalName: m.OriginalName,
+		URL:          tools.MediaURL(m.FileName),
+		Width:        m.Width,
+		Height:       m.Height,
+	}
+}
+
+// WriteJSON writes the archive as indented JSON.
+func WriteJSON(w io.Writer, a *Archive) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// WriteZip writes a zip holding archive.json plus one Markdown file with
+// front matter per post under posts/.
+func WriteZip(w io.Writer, a *Archive) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create("archive.json")
+	if err != nil {
+		return err
+	}
+	if err := WriteJSON(f, a); err != nil {
+		return err
+	}
+
+	authors := map[string]Author{}
+	for _, author := range a.Authors {
+		authors[author.ID] = author
+	}
+	for _, post := range a.Posts {
+		name := fmt.Sprintf("posts/%d.md", post.ID)
+		if post.Slug != "" {
+			name = fmt.Sprintf("posts/%d-%s.md", post.ID, post.Slug)
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, markdownFile(post, authors[post.AuthorID])); err != nil {
+			return err
+		}
+	}
+
+	// Uploaded files travel with the archive, so they can be imported
+	// elsewhere
+	seen := map[string]bool{}
+	for _, post := range a.Posts {
+		refs := post.Media
+		if post.Cover != nil {
+			refs = append([]MediaRef{*post.Cover}, refs...)
+		}
+		for _, ref := range refs {
+			if seen[ref.FileName] || ref.FileName == "" || strings.ContainsAny(ref.FileName, `/\`) {
+				continue
+			}
+			seen[ref.FileName] = true
+			if err := copyToZip(zw, mediaDir+ref.FileName, tools.UploadDir+ref.FileName); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// copyToZip adds a file to the zip. Missing files are left out.
+func copyToZip(zw *zip.Writer, name, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer src.Close()
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// markdownFile renders a post as Markdown with YAML front matter.
+func markdownFile(post Post, author Author) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "title: %s\n", yamlString(post.Title))
+	fmt.Fprintf(&b, "date: %s\n", post.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated: %s\n", post.UpdatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "author: %s\n", yamlString(strings.TrimSpace(author.FirstName+" "+author.LastName)))
+	if author.Email != "" {
+		fmt.Fprintf(&b, "author_email: %s\n", yamlString(author.Email))
+	}
+	fmt.Fprintf(&b, "visibility: %s\n", yamlString(post.Visibility))
+	if len(post.Tags) > 0 {
+		b.WriteString("tags:\n")
+		for _, tag := range post.Tags {
+			fmt.Fprintf(&b, "  - %s\n", yamlString(tag))
+		}
+	}
+	if post.Cover != nil {
+		fmt.Fprintf(&b, "cover: %s\n", yamlString(post.Cover.URL))
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(post.Body)
+	if !strings.HasSuffix(post.Body, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// yamlString quotes a value as a YAML double-quoted scalar.
+func yamlString(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
@@ -0,0 +1,416 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// Kinds of imported items tracked in structures.ImportRecord.
+const (
+	kindPost    = "post"
+	kindComment = "comment"
+)
+
+// ImportOptions controls how archive authors are mapped onto local users.
+type ImportOptions struct {
+	// AuthorMap maps archive author IDs to local user IDs explicitly.
+	AuthorMap map[string]uint
+	// MatchEmail maps authors onto local accounts with the same email.
+	MatchEmail bool
+	// FallbackUserID receives the content of authors that can't be mapped.
+	// When zero such content is skipped.
+	FallbackUserID uint
+	// ImportedBy is the user running the import through the API. Items
+	// are only recognised as already imported from that user's earlier
+	// imports. Zero for imports run from the command line.
+	ImportedBy uint
+	// ScreenPost, when set, is called on every new post before it is saved
+	// and may hold it for moderation.
+	ScreenPost func(blog *structures.Blog)
+	// ScreenComment, when set, is called on every new comment before it is
+	// saved. It may hold the comment for moderation, or refuse it by
+	// returning false.
+	ScreenComment func(comment *structures.Comment, post structures.Blog) bool
+}
+
+// Report summarises what an import did.
+type Report struct {
+	PostsCreated    int      `json:"posts_created"`
+	PostsSkipped    int      `json:"posts_skipped"`
+	CommentsCreated int      `json:"comments_created"`
+	CommentsSkipped int      `json:"comments_skipped"`
+	Remapped        []string `json:"remapped"`
+	Skipped         []string `json:"skipped"`
+	Warnings        []string `json:"warnings"`
+}
+
+func (r *Report) skip(format string, args ...interface{}) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Decode reads an archive from JSON or from a zip written by WriteZip.
+func Decode(data []byte) (*Archive, error) {
+	if bytes.HasPrefix(data, []byte("PK")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		f, err := zr.Open("archive.json")
+		if err != nil {
+			return nil, errors.New("zip archive has no archive.json")
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+		a, err := decodeJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		a.media = map[string]*zip.File{}
+		for _, file := range zr.File {
+			if name := strings.TrimPrefix(file.Name, mediaDir); name != file.Name {
+				a.media[name] = file
+			}
+		}
+		return a, nil
+	}
+	return decodeJSON(data)
+}
+
+func decodeJSON(data []byte) (*Archive, error) {
+	var a Archive
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, err
+	}
+	if a.Version < 1 || a.Version > Version {
+		return nil, fmt.Errorf("unsupported archive version %d", a.Version)
+	}
+	if a.Origin == "" {
+		return nil, errors.New("archive has no origin")
+	}
+	return &a, nil
+}
+
+// Import writes the content of an archive into the database. Authors are
+// mapped through opts, timestamps are kept, and every imported item is
+// recorded so that importing the same archive again skips it.
+func Import(a *Archive, opts ImportOptions) (*Report, error) {
+	report := &Report{Remapped: []string{}, Skipped: []string{}, Warnings: []string{}}
+	authors := mapAuthors(a, opts, report)
+	authorFor := func(id string) (uint, bool) {
+		if user, ok := authors[id]; ok {
+			return user, true
+		}
+		if opts.FallbackUserID == 0 {
+			return 0, false
+		}
+		// Authors the archive doesn't describe go to the fallback user too
+		authors[id] = opts.FallbackUserID
+		report.Remapped = append(report.Remapped, fmt.Sprintf("author %s (unknown) -> user %d (fallback)", id, opts.FallbackUserID))
+		return opts.FallbackUserID, true
+	}
+
+	importer := ""
+	if opts.ImportedBy != 0 {
+		importer = strconv.Itoa(int(opts.ImportedBy))
+	}
+
+	postIDs := map[uint]uint{}
+	for _, post := range a.Posts {
+		source := strconv.Itoa(int(post.ID))
+		if target, ok := Imported(importer, a.Origin, kindPost, source); ok {
+			var count int64
+			db.DB.Model(&structures.Blog{}).Where("id = ?", target).Count(&count)
+			if count > 0 {
+				postIDs[post.ID] = target
+				report.PostsSkipped++
+				continue
+			}
+			// The post was deleted since: import it again
+			Forget(importer, a.Origin, kindPost, source)
+		}
+		userID, ok := authorFor(post.AuthorID)
+		if !ok {
+			report.PostsSkipped++
+			report.skip("post %d %q: author %s could not be mapped", post.ID, post.Title, post.AuthorID)
+			continue
+		}
+
+		blog := structures.Blog{
+			Title:      post.Title,
+			Desc:       post.Body,
+			UserID:     strconv.Itoa(int(userID)),
+			Visibility: post.Visibility,
+			CreatedAt:  post.CreatedAt,
+			UpdatedAt:  post.UpdatedAt,
+		}
+		if !structures.ValidVisibility(blog.Visibility) {
+			blog.Visibility = structures.VisibilityPublic
+		}
+		blog.Excerpt, blog.WordCount, blog.ReadingMinutes = tools.Summarize(blog.Desc)
+		if opts.ScreenPost != nil {
+			opts.ScreenPost(&blog)
+		}
+		if post.Cover != nil {
+			if media, ok := importMedia(a, *post.Cover, blog.UserID, report); ok {
+				blog.CoverMediaID = &media.ID
+			}
+		}
+
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Tags").Create(&blog).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&structures.User{}).Where("id = ?", blog.UserID).
+				UpdateColumn("post_count", gorm.Expr("post_count + 1")).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&blog).Association("Tags").Replace(ResolveTags(tx, post.Tags)); err != nil {
+				return err
+			}
+			for i, ref := range post.Media {
+				media, ok := importMedia(a, ref, blog.UserID, report)
+				if !ok {
+					continue
+				}
+				if err := tx.Create(&structures.PostMedia{PostID: blog.Id, MediaID: media.ID, Position: i}).Error; err != nil {
+					return err
+				}
+			}
+			return Record(tx, importer, a.Origin, kindPost, source, blog.Id)
+		})
+		if err != nil {
+			return report, err
+		}
+		postIDs[post.ID] = blog.Id
+		report.PostsCreated++
+	}
+
+	// Parents are imported before their replies
+	comments := append([]Comment(nil), a.Comments...)
+	sort.SliceStable(comments, func(i, j int) bool { return comments[i].ID < comments[j].ID })
+	for _, comment := range comments {
+		source := strconv.Itoa(int(comment.ID))
+		if _, ok := Imported(importer, a.Origin, kindComment, source); ok {
+			report.CommentsSkipped++
+			continue
+		}
+		postID, ok := postIDs[comment.PostID]
+		if !ok {
+			report.CommentsSkipped++
+			report.skip("comment %d: post %d was not imported", comment.ID, comment.PostID)
+			continue
+		}
+		userID, ok := authorFor(comment.AuthorID)
+		if !ok {
+			report.CommentsSkipped++
+			report.skip("comment %d: author %s could not be mapped", comment.ID, comment.AuthorID)
+			continue
+		}
+
+		c := structures.Comment{
+			UserID:   strconv.Itoa(int(userID)),
+			PostID:   postID,
+			Content:  comment.Content,
+			DateTime: comment.CreatedAt,
+		}
+		if comment.ParentID != nil {
+			parentSource := strconv.Itoa(int(*comment.ParentID))
+			if parent, ok := ReplyParent(importer, a.Origin, kindComment, parentSource); ok && parent.PostID == postID {
+				c.ParentID = &parent.ID
+				c.Depth = parent.Depth + 1
+			} else {
+				report.Remapped = append(report.Remapped, fmt.Sprintf("comment %d: parent %d was not imported -> top level", comment.ID, *comment.ParentID))
+			}
+		}
+		if opts.ScreenComment != nil {
+			var post structures.Blog
+			if err := db.DB.Where("id = ?", postID).First(&post).Error; err != nil || !opts.ScreenComment(&c, post) {
+				report.CommentsSkipped++
+				report.skip("comment %d: commenting on post %d is not allowed", comment.ID, comment.PostID)
+				continue
+			}
+		}
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&c).Error; err != nil {
+				return err
+			}
+			// Held replies only count once approved
+			if c.ParentID != nil && (c.Status == "" || c.Status == structures.CommentApproved) {
+				if err := tx.Model(&structures.Comment{}).Where("id = ?", *c.ParentID).
+					UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error; err != nil {
+					return err
+				}
+			}
+			return Record(tx, importer, a.Origin, kindComment, source, c.ID)
+		})
+		if err != nil {
+			return report, err
+		}
+		report.CommentsCreated++
+	}
+
+	return report, nil
+}
+
+// mapAuthors resolves every archive author to a local user ID. Authors
+// missing from the result have their content skipped.
+func mapAuthors(a *Archive, opts ImportOptions, report *Report) map[string]uint {
+	mapped := map[string]uint{}
+	for _, author := range a.Authors {
+		name := strings.TrimSpace(author.FirstName + " " + author.LastName)
+		if id, ok := opts.AuthorMap[author.ID]; ok {
+			mapped[author.ID] = id
+			report.Remapped = append(report.Remapped, fmt.Sprintf("author %s (%s) -> user %d (explicit)", author.ID, name, id))
+			continue
+		}
+		if opts.MatchEmail && author.Email != "" {
+			var user structures.User
+			if err := db.DB.Where("email = ?", author.Email).First(&user).Error; err == nil {
+				mapped[author.ID] = user.Id
+				report.Remapped = append(report.Remapped, fmt.Sprintf("author %s (%s) -> user %d (same email)", author.ID, name, user.Id))
+				continue
+			}
+		}
+		if opts.FallbackUserID != 0 {
+			mapped[author.ID] = opts.FallbackUserID
+			report.Remapped = append(report.Remapped, fmt.Sprintf("author %s (%s) -> user %d (fallback)", author.ID, name, opts.FallbackUserID))
+		}
+	}
+	// Explicit mappings also apply to authors the archive doesn't describe
+	for id, user := range opts.AuthorMap {
+		if _, ok := mapped[id]; !ok {
+			mapped[id] = user
+		}
+	}
+	return mapped
+}
+
+// importMedia links a media reference to a local Media row of the user.
+// Media the user already owns under that file name, or copied by an earlier
+// import, is reused; otherwise the file is copied out of the zip archive.
+// Files already in the upload directory are never claimed, as they may
+// belong to someone else.
+func importMedia(a *Archive, ref MediaRef, userID string, report *Report) (structures.Media, bool) {
+	var media structures.Media
+	if ref.FileName == "" || strings.ContainsAny(ref.FileName, `/\`) {
+		report.warn("media %q has an invalid file name", ref.FileName)
+		return media, false
+	}
+	fileName := "import-" + userID + "-" + ref.FileName
+	if err := db.DB.Where("file_name IN ? AND user_id = ?", []string{ref.FileName, fileName}, userID).First(&media).Error; err == nil {
+		return media, true
+	}
+	file, ok := a.media[ref.FileName]
+	if !ok {
+		report.warn("media %q is missing from the archive", ref.FileName)
+		return media, false
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		report.warn("media %q could not be read: %v", ref.FileName, err)
+		return media, false
+	}
+	defer src.Close()
+	dst, err := os.Create(tools.UploadDir + fileName)
+	if err != nil {
+		report.warn("media %q could not be copied: %v", ref.FileName, err)
+		return media, false
+	}
+	size, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		report.warn("media %q could not be copied: %v", ref.FileName, err)
+		return media, false
+	}
+
+	media = structures.Media{
+		UserID:       userID,
+		FileName:     fileName,
+		OriginalName: ref.OriginalName,
+		Size:         size,
+	}
+	media.Width, media.Height = tools.ImageSize(tools.UploadDir + fileName)
+	if err := db.DB.Create(&media).Error; err != nil {
+		report.warn("media %q could not be recorded: %v", ref.FileName, err)
+		return media, false
+	}
+	return media, true
+}
+
+// ResolveTags finds or creates the tags with the given names.
+func ResolveTags(tx *gorm.DB, names []string) []structures.Tag {
+	var tags []structures.Tag
+	seen := map[string]bool{}
+	for _, name := range names {
+		slug := structures.Slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tag := structures.Tag{Name: strings.TrimSpace(name), Slug: slug}
+		if err := tx.Where("slug = ?", slug).FirstOrCreate(&tag).Error; err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Imported returns the local ID of an item an earlier import from origin
+// created, if any. importer is the ID of the user who ran the import, or ""
+// for imports run from the command line.
+func Imported(importer, origin, kind, source string) (uint, bool) {
+	var rec structures.ImportRecord
+	err := db.DB.Where("imported_by = ? AND origin = ? AND kind = ? AND source_id = ?", importer, origin, kind, source).First(&rec).Error
+	return rec.TargetID, err == nil
+}
+
+// ReplyParent loads the comment an imported reply hangs under: the one
+// imported from source or, when that one is nested as deep as
+// tools.MaxCommentDepth, its deepest ancestor that isn't.
+func ReplyParent(importer, origin, kind, source string) (structures.Comment, bool) {
+	var parent structures.Comment
+	id, ok := Imported(importer, origin, kind, source)
+	if !ok || db.DB.Where("id = ?", id).First(&parent).Error != nil {
+		return parent, false
+	}
+	for parent.Depth >= tools.MaxCommentDepth() && parent.ParentID != nil {
+		var up structures.Comment
+		if err := db.DB.Where("id = ?", *parent.ParentID).First(&up).Error; err != nil {
+			break
+		}
+		parent = up
+	}
+	return parent, true
+}
+
+// Record notes that an import created the local item target from source.
+func Record(tx *gorm.DB, importer, origin, kind, source string, target uint) error {
+	return tx.Create(&structures.ImportRecord{ImportedBy: importer, Origin: origin, Kind: kind, SourceID: source, TargetID: target}).Error
+}
+
+// Forget drops the record of an imported item, so that it is imported again.
+func Forget(importer, origin, kind, source string) {
+	db.DB.Where("imported_by = ? AND origin = ? AND kind = ? AND source_id = ?", importer, origin, kind, source).Delete(&structures.ImportRecord{})
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aizeresalim/final/archive"
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/mention"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"github.com/aizeresalim/final/wordpress"
+	"gorm.io/gorm"
+)
+
+// runCommand runs a maintenance command given on the command line instead of
+// starting the server:
+//
+//	final export [-user ID] [-format json|zip] [-out FILE]
+//	final import -file FILE [-fallback-user ID] [-match-email=false] [-author-map 1=5,2=7]
+//	final wordpress -file FILE [-media-dir DIR] [-fallback-user ID] [-pages]
+//	final handles
+//	final counters
+//	final summaries
+//	final role -user ID -role user|moderator|admin
+func runCommand(args []string) error {
+	switch args[0] {
+	case "export":
+		return exportCommand(args[1:])
+	case "import":
+		return importCommand(args[1:])
+	case "wordpress":
+		return wordpressCommand(args[1:])
+	case "handles":
+		return handlesCommand()
+	case "counters":
+		return countersCommand()
+	case "summaries":
+		return summariesCommand()
+	case "role":
+		return roleCommand(args[1:])
+	}
+	return fmt.Errorf("unknown command %q, use export, import, wordpress, handles, counters, summaries or role", args[0])
+}
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	user := fs.String("user", "", "export only the posts of this user ID")
+	format := fs.String("format", "json", "archive format: json or zip")
+	out := fs.String("out", "", "output file (default stdout)")
+	origin := fs.String("origin", os.Getenv("SITE_URL"), "origin recorded in the archive")
+	fs.Parse(args)
+
+	if *origin == "" {
+		return errors.New("set SITE_URL or pass -origin")
+	}
+	a, err := archive.Export(*origin, *user)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "zip" {
+		return archive.WriteZip(w, a)
+	}
+	return archive.WriteJSON(w, a)
+}
+
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "JSON or zip archive to import")
+	fallback := fs.Uint("fallback-user", 0, "user ID receiving content of unmapped authors")
+	matchEmail := fs.Bool("match-email", true, "map authors onto accounts with the same email")
+	authorMap := fs.String("author-map", "", "explicit author mapping, e.g. 1=5,2=7")
+	fs.Parse(args)
+
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	a, err := archive.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	opts := archive.ImportOptions{
+		AuthorMap:      map[string]uint{},
+		MatchEmail:     *matchEmail,
+		FallbackUserID: *fallback,
+	}
+	for _, pair := range strings.Split(*authorMap, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid author mapping %q", pair)
+		}
+		target, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid author mapping %q", pair)
+		}
+		opts.AuthorMap[strings.TrimSpace(parts[0])] = uint(target)
+	}
+
+	report, err := archive.Import(a, opts)
+	if report != nil {
+		printReport(report)
+	}
+	return err
+}
+
+func wordpressCommand(args []string) error {
+	fs := flag.NewFlagSet("wordpress", flag.ExitOnError)
+	file := fs.String("file", "", "WXR export file to import")
+	mediaDir := fs.String("media-dir", "", "local copy of wp-content/uploads")
+	fallback := fs.Uint("fallback-user", 0, "user ID receiving comments left without an email")
+	pages := fs.Bool("pages", false, "import pages as posts")
+	fs.Parse(args)
+
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	export, err := wordpress.Parse(f)
+	if err != nil {
+		return err
+	}
+
+	report, err := wordpress.Import(export, wordpress.Options{
+		MediaDir:       *mediaDir,
+		FallbackUserID: *fallback,
+		Pages:          *pages,
+	})
+	if report != nil {
+		printReport(report)
+	}
+	return err
+}
+
+// handlesCommand gives a handle to the users created before handles
+// existed, so that they can be mentioned.
+func handlesCommand() error {
+	var users []structures.User
+	if err := db.DB.Where("handle = ? OR handle IS NULL", "").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		handle := mention.NewHandle(user)
+		if err := db.DB.Model(&user).UpdateColumn("handle", handle).Error; err != nil {
+			return err
+		}
+		fmt.Printf("user %d -> @%s\n", user.Id, handle)
+	}
+	return nil
+}
+
+// countersCommand recomputes the follower, following and post counters of
+// every user from the follows and posts tables.
+func countersCommand() error {
+	result := db.DB.Model(&structures.User{}).Where("1 = 1").UpdateColumns(map[string]interface{}{
+		"follower_count":  db.DB.Model(&structures.Follow{}).Select("COUNT(*)").Where("follows.followed_user_id = users.id"),
+		"following_count": db.DB.Model(&structures.Follow{}).Select("COUNT(*)").Where("follows.follower_id = users.id"),
+		"post_count":      db.DB.Model(&structures.Blog{}).Select("COUNT(*)").Where("blogs.user_id = users.id"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	fmt.Printf("recounted %d users\n", result.RowsAffected)
+	return nil
+}
+
+// summariesCommand computes the excerpt, word count and reading time of
+// the posts saved before they existed.
+func summariesCommand() error {
+	var posts []structures.Blog
+	updated := 0
+	result := db.DB.Where("excerpt = ? OR excerpt IS NULL", "").FindInBatches(&posts, 100, func(tx *gorm.DB, batch int) error {
+		for _, post := range posts {
+			if post.Desc == "" {
+				continue
+			}
+			excerpt, words, minutes := tools.Summarize(post.Desc)
+			err := db.DB.Model(&structures.Blog{}).Where("id = ?", post.Id).UpdateColumns(map[string]interface{}{
+				"excerpt":         excerpt,
+				"word_count":      words,
+				"reading_minutes": minutes,
+			}).Error
+			if err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	fmt.Printf("summarised %d posts\n", updated)
+	return nil
+}
+
+// roleCommand sets the role of a user, e.g. to make the first admin.
+func roleCommand(args []string) error {
+	fs := flag.NewFlagSet("role", flag.ExitOnError)
+	user := fs.Uint("user", 0, "user ID")
+	role := fs.String("role", "", "new role: user, moderator or admin")
+	fs.Parse(args)
+
+	if *user == 0 || !structures.ValidRole(*role) {
+		return errors.New("-user and -role (user, moderator or admin) are required")
+	}
+	result := db.DB.Model(&structures.User{}).Where("id = ?", *user).Update("role", *role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user %d not found or already %s", *user, *role)
+	}
+	fmt.Printf("user %d is now %s\n", *user, *role)
+	return nil
+}
+
+func printReport(report interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(report)
+}
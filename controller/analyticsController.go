@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/analytics"
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+type dailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+type referrerCount struct {
+	Host  string `json:"host"`
+	Views int64  `json:"views"`
+}
+
+// PostAnalytics returns the daily views, top referrers and reaction and
+// comment trends of a post over the last ?days= days (default 30). Only the
+// authors of the post can see them.
+func PostAnalytics(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+
+	// Check if the blog post exists and belongs to the user
+	var blogPost structures.Blog
+	if err := db.DB.Where("id = ?", postID).First(&blogPost).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Blog post not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+	if postRole(blogPost, userID) == "" {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Only the authors can see post analytics",
+		})
+	}
+
+	days, _ := strconv.Atoi(c.Query("days", "30"))
+	if days < 1 || days > 365 {
+		days = 30
+	}
+	since := time.Now().AddDate(0, 0, -days+1).Truncate(24 * time.Hour)
+
+	// Flush buffered views so the numbers include the latest visits
+	analytics.Flush()
+
+	var viewStats []structures.PostDailyStat
+	db.DB.Where("post_id = ? AND day >= ?", postID, since).Order("day").Find(&viewStats)
+	views := make([]dailyCount, len(viewStats))
+	var periodViews int64
+	for i, stat := range viewStats {
+		views[i] = dailyCount{Day: stat.Day.Format("2006-01-02"), Count: stat.Views}
+		periodViews += stat.Views
+	}
+
+	var totalViews int64
+	db.DB.Model(&structures.PostDailyStat{}).Where("post_id = ?", postID).
+		Select("COALESCE(SUM(views), 0)").Scan(&totalViews)
+
+	var referrers []referrerCount
+	db.DB.Model(&structures.PostReferrerStat{}).
+		Select("host, SUM(views) as views").
+		Where("post_id = ? AND day >= ?", postID, since).
+		Group("host").Order("views desc").Limit(20).
+		Scan(&referrers)
+
+	var reactions []dailyCount
+	db.DB.Model(&structures.Reaction{}).
+		Select("DATE_FORMAT(created_at, '%Y-%m-%d') as day, count(*) as count").
+		Where("target_type = ? AND target_id = ? AND created_at >= ?", structures.ReactionTargetPost, postID, since).
+		Group("day").Order("day").
+		Scan(&reactions)
+
+	var comments []dailyCount
+	db.DB.Model(&structures.Comment{}).
+		Select("DATE_FORMAT(date_time, '%Y-%m-%d') as day, count(*) as count").
+		Where("post_id = ? AND status = ? AND date_time >= ?", postID, structures.CommentApproved, since).
+		Group("day").Order("day").
+		Scan(&comments)
+
+	return c.JSON(fiber.Map{
+		"post_id":      postID,
+		"days":         days,
+		"total_views":  totalViews,
+		"period_views": periodViews,
+		"views":        views,
+		"referrers":    referrers,
+		"reactions":    reactions,
+		"comments":     comments,
+	})
+}
+
+// recordView counts a view of the post for the visitor making the request.
+// Bots are ignored.
+func recordView(c *fiber.Ctx, postID uint, userID string) {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if analytics.IsBot(userAgent) {
+		return
+	}
+	visitor := analytics.VisitorKey(userID, c.IP(), userAgent)
+	analytics.Record(postID, visitor, analytics.ReferrerHost(c.Get(fiber.HeaderReferer), c.Hostname()))
+}
+
+// attachViewCounts fills in the total view count of the given posts.
+func attachViewCounts(posts []structures.Blog) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uint, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	var rows []struct {
+		PostID uint
+		Total  int64
+	}
+	db.DB.Model(&structures.PostDailyStat{}).
+		Select("post_id, SUM(views) as total").
+		Where("post_id IN ?", ids).
+		Group("post_id").
+		Scan(&rows)
+	totals := map[uint]int64{}
+	for _, row := range rows {
+		totals[row.PostID] = row.Total
+	}
+	for i := range posts {
+		total := totals[posts[i].Id] + analytics.Pending(posts[i].Id)
+		posts[i].Views = &total
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/archive"
+	"github.com/aizeresalim/final/spam"
+	"github.com/aizeresalim/final/structures"
+)
+
+// ExportContent downloads the current user's content, or the whole site's
+// with ?scope=site (admins only), as a JSON archive or, with ?format=zip, a
+// zip of Markdown files with front matter.
+func ExportContent(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	userID := strconv.Itoa(int(user.Id))
+	if c.Query("scope") == "site" {
+		if !user.IsAdmin() {
+			c.Status(fiber.StatusForbidden)
+			return c.JSON(fiber.Map{
+				"message": "Only admins can export the whole site",
+			})
+		}
+		userID = ""
+	}
+
+	a, err := archive.Export(siteURL(c), userID)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to export content",
+		})
+	}
+
+	var buf bytes.Buffer
+	name := "export-" + time.Now().UTC().Format("20060102-150405")
+	if c.Query("format") == "zip" {
+		err = archive.WriteZip(&buf, a)
+		name += ".zip"
+		c.Set(fiber.HeaderContentType, "application/zip")
+	} else {
+		err = archive.WriteJSON(&buf, a)
+		name += ".json"
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to export content",
+		})
+	}
+
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	return c.Send(buf.Bytes())
+}
+
+// ImportContent imports a JSON or zip archive uploaded as the "archive"
+// form file. Regular users import the posts as their own. Admins
+// can map authors onto existing accounts by email (match_email, on by
+// default) or explicitly with an author_map form field holding a JSON
+// object of archive author ID to local user ID.
+func ImportContent(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	file, err := c.FormFile("archive")
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Archive file is required",
+		})
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Unable to read archive",
+		})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Unable to read archive",
+		})
+	}
+
+	a, err := archive.Decode(data)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid archive",
+			"error":   err.Error(),
+		})
+	}
+
+	// Imported content goes through the same checks as content written here
+	opts := archive.ImportOptions{
+		ImportedBy:    user.Id,
+		ScreenPost:    screenImportedPost,
+		ScreenComment: screenImportedComment,
+	}
+	if user.IsAdmin() {
+		opts.FallbackUserID = user.Id
+		opts.MatchEmail = c.FormValue("match_email", "true") != "false"
+		if raw := c.FormValue("author_map"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &opts.AuthorMap); err != nil {
+				c.Status(fiber.StatusBadRequest)
+				return c.JSON(fiber.Map{
+					"message": "Invalid author_map",
+				})
+			}
+		}
+	} else {
+		// Posts land on the importing user's account; comments by other
+		// people can't be attributed and are skipped
+		opts.AuthorMap = map[string]uint{}
+		for _, post := range a.Posts {
+			opts.AuthorMap[post.AuthorID] = user.Id
+		}
+	}
+
+	report, err := archive.Import(a, opts)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Import failed",
+			"report":  report,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Import finished",
+		"report":  report,
+	})
+}
+
+// screenImportedPost holds imported posts that look like spam.
+func screenImportedPost(blog *structures.Blog) {
+	if verdict := screenSpam(spam.Content{Kind: spam.KindPost, UserID: blog.UserID, Title: blog.Title, Body: blog.Desc}); verdict.Spam {
+		blog.Status, blog.HeldReason = structures.PostPending, heldReason(verdict)
+	}
+}
+
+// screenImportedComment refuses imported comments their writer couldn't
+// post here, and holds the ones that must wait for moderation.
+func screenImportedComment(comment *structures.Comment, post structures.Blog) bool {
+	if allowed, _ := mayComment(post, comment.UserID); !allowed {
+		return false
+	}
+	if holdComment(post, comment.UserID) {
+		comment.Status = structures.CommentPending
+	}
+	if verdict := screenSpam(spam.Content{Kind: spam.KindComment, UserID: comment.UserID, Body: comment.Content}); verdict.Spam {
+		comment.Status, comment.HeldReason = structures.CommentPending, heldReason(verdict)
+	}
+	return true
+}
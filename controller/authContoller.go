@@ -11,6 +11,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/mention"
 	"github.com/aizeresalim/final/structures"
 	"github.com/aizeresalim/final/tools"
 )
@@ -29,6 +30,7 @@ func Register(c *fiber.Ctx) error {
 	firstName := c.FormValue("first_name")
 	lastName := c.FormValue("last_name")
 	phone := c.FormValue("phone")
+	handle := strings.TrimPrefix(strings.TrimSpace(c.FormValue("handle")), "@")
 
 	// Validate email format
 	if len(email) == 0 || !validateEmail(strings.TrimSpace(email)) {
@@ -55,12 +57,30 @@ func Register(c *fiber.Ctx) error {
 		})
 	}
 
+	// Users pick the handle others @mention them by, or get one from their name
+	if handle != "" && !mention.ValidHandle(handle) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Handles are 2 to 32 letters, digits or underscores",
+		})
+	}
+	if handle != "" && mention.Taken(handle, "") {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Handle already taken",
+		})
+	}
+
 	// Create user
 	user := structures.User{
 		FirstName: firstName,
 		LastName:  lastName,
 		Phone:     phone,
 		Email:     email,
+		Handle:    handle,
+	}
+	if user.Handle == "" {
+		user.Handle = mention.NewHandle(user)
 	}
 	user.SetPassword(password)
 	err := db.DB.Create(&user)
@@ -138,3 +158,14 @@ func Login(c *fiber.Ctx) error {
 type Claims struct {
 	jwt.StandardClaims
 }
+
+// currentUser loads the user making the request from the jwt cookie.
+func currentUser(c *fiber.Ctx) (structures.User, error) {
+	var user structures.User
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		return user, err
+	}
+	err = db.DB.Where("id = ?", userID).First(&user).Error
+	return user, err
+}
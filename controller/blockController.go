@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// BlockUser blocks the user named in the URL. Blocked users can still read
+// the blocker's posts, but their mentions and other actions no longer
+// notify them.
+func BlockUser(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	blockedID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	if strconv.Itoa(blockedID) == userID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Cannot block yourself",
+		})
+	}
+
+	var blocked structures.User
+	if err := db.DB.First(&blocked, blockedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	block := structures.Block{UserID: userID, BlockedID: strconv.Itoa(blockedID)}
+	if err := db.DB.Where(&block).FirstOrCreate(&block).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to block user",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User blocked",
+	})
+}
+
+// UnblockUser lifts the block on the user named in the URL.
+func UnblockUser(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	result := db.DB.Where("user_id = ? AND blocked_id = ?", userID, c.Params("id")).Delete(&structures.Block{})
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to unblock user",
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User not blocked",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unblocked",
+	})
+}
+
+// MyBlocks lists the users the current user blocked, most recent first.
+func MyBlocks(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var blocks []structures.Block
+	if err := db.DB.Where("user_id = ?", userID).Preload("Blocked").Order("created_at desc").Find(&blocks).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve blocked users",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"blocks": blocks,
+	})
+}
@@ -0,0 +1,488 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// AddBookmark saves a post for the current user.
+func AddBookmark(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+
+	// Check if the blog post exists
+	var blogPost structures.Blog
+	if err := db.DB.Where("id = ?", postID).First(&blogPost).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Blog post not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+	if !canReadPost(blogPost, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	// Check if the post is already bookmarked
+	var bookmark structures.Bookmark
+	if err := db.DB.Where("user_id = ? AND post_id = ?", userID, postID).First(&bookmark).Error; err == nil {
+		return c.JSON(fiber.Map{
+			"message":  "Post already bookmarked",
+			"bookmark": bookmark,
+		})
+	}
+
+	bookmark = structures.Bookmark{
+		UserID: userID,
+		PostID: uint(postID),
+	}
+	if err := db.DB.Create(&bookmark).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to bookmark post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":  "Post bookmarked",
+		"bookmark": bookmark,
+	})
+}
+
+// RemoveBookmark removes a post from the current user's bookmarks.
+func RemoveBookmark(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+
+	result := db.DB.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&structures.Bookmark{})
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to remove bookmark",
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Bookmark not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Bookmark removed",
+	})
+}
+
+// ListBookmarks returns the posts bookmarked by the current user, newest
+// first.
+func ListBookmarks(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	var total int64
+	var bookmarks []structures.Bookmark
+	readable := db.DB.Model(&structures.Blog{}).Select("id").Scopes(readablePosts(userID))
+	db.DB.Model(&structures.Bookmark{}).Where("user_id = ? AND post_id IN (?)", userID, readable).Count(&total)
+	if err := db.DB.Where("user_id = ? AND post_id IN (?)", userID, readable).Preload("Post.User").
+		Order("created_at desc").Offset(offset).Limit(limit).Find(&bookmarks).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve bookmarks",
+		})
+	}
+
+	posts := make([]structures.Blog, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		posts[i] = bookmark.Post
+	}
+	decoratePosts(posts, userID)
+	listFields(c, posts)
+
+	return c.JSON(fiber.Map{
+		"data": posts,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// CreateReadingList creates a new reading list for the current user.
+func CreateReadingList(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var listData structures.ReadingList
+	if err := c.BodyParser(&listData); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid reading list payload",
+		})
+	}
+	if strings.TrimSpace(listData.Name) == "" {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Reading list name is required",
+		})
+	}
+
+	list := structures.ReadingList{
+		UserID:      userID,
+		Name:        strings.TrimSpace(listData.Name),
+		Description: listData.Description,
+		Public:      listData.Public,
+	}
+	if err := db.DB.Create(&list).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to create reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reading list created",
+		"list":    list,
+	})
+}
+
+// MyReadingLists returns every reading list of the current user.
+func MyReadingLists(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var lists []structures.ReadingList
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&lists).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve reading lists",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"lists": lists,
+	})
+}
+
+// UserReadingLists returns the public reading lists of a user.
+func UserReadingLists(c *fiber.Ctx) error {
+	ownerID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+
+	var lists []structures.ReadingList
+	if err := db.DB.Where("user_id = ? AND public = ?", ownerID, true).Order("created_at").Find(&lists).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve reading lists",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"lists": lists,
+	})
+}
+
+// GetReadingList returns a reading list with its posts in order. Private
+// lists are only visible to their owner.
+func GetReadingList(c *fiber.Ctx) error {
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+
+	list, status, message := findReadingList(c.Params("listID"))
+	if status != 0 {
+		c.Status(status)
+		return c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+	if !list.Public && list.UserID != userID {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Reading list not found",
+		})
+	}
+
+	var items []structures.ReadingListItem
+	readable := db.DB.Model(&structures.Blog{}).Select("id").Scopes(readablePosts(userID))
+	if err := db.DB.Where("list_id = ? AND post_id IN (?)", list.ID, readable).Preload("Post.User").Order("position").Find(&items).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve reading list",
+		})
+	}
+
+	posts := make([]structures.Blog, len(items))
+	for i, item := range items {
+		posts[i] = item.Post
+	}
+	decoratePosts(posts, userID)
+	listFields(c, posts)
+	for i := range items {
+		items[i].Post = posts[i]
+	}
+	list.Items = items
+
+	return c.JSON(fiber.Map{
+		"list": list,
+	})
+}
+
+// UpdateReadingList renames a reading list or changes its visibility.
+func UpdateReadingList(c *fiber.Ctx) error {
+	list, ok, err := ownedReadingList(c)
+	if !ok {
+		return err
+	}
+
+	var listData struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+	}
+	if err := c.BodyParser(&listData); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid reading list payload",
+		})
+	}
+	if listData.Name != nil {
+		if strings.TrimSpace(*listData.Name) == "" {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Reading list name is required",
+			})
+		}
+		list.Name = strings.TrimSpace(*listData.Name)
+	}
+	if listData.Description != nil {
+		list.Description = *listData.Description
+	}
+	if listData.Public != nil {
+		list.Public = *listData.Public
+	}
+
+	if err := db.DB.Save(&list).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to update reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reading list updated",
+		"list":    list,
+	})
+}
+
+// DeleteReadingList deletes a reading list and its items.
+func DeleteReadingList(c *fiber.Ctx) error {
+	list, ok, err := ownedReadingList(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Where("list_id = ?", list.ID).Delete(&structures.ReadingListItem{}).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to delete reading list",
+		})
+	}
+	if err := db.DB.Delete(&list).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to delete reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Reading list deleted",
+	})
+}
+
+// AddToReadingList appends a post to the end of a reading list.
+func AddToReadingList(c *fiber.Ctx) error {
+	list, ok, err := ownedReadingList(c)
+	if !ok {
+		return err
+	}
+
+	// Check if the blog post exists
+	blogPost, ok, err := collectedPost(c)
+	if !ok {
+		return err
+	}
+	if !canReadPost(blogPost, list.UserID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	var item structures.ReadingListItem
+	if err := db.DB.Where("list_id = ? AND post_id = ?", list.ID, blogPost.Id).First(&item).Error; err == nil {
+		return c.JSON(fiber.Map{
+			"message": "Post already in reading list",
+			"item":    item,
+		})
+	}
+
+	item = structures.ReadingListItem{
+		ListID:   list.ID,
+		PostID:   blogPost.Id,
+		Position: readingListPosts(list).nextPosition(),
+	}
+	if err := db.DB.Create(&item).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to add post to reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post added to reading list",
+		"item":    item,
+	})
+}
+
+// RemoveFromReadingList removes a post from a reading list.
+func RemoveFromReadingList(c *fiber.Ctx) error {
+	list, ok, err := ownedReadingList(c)
+	if !ok {
+		return err
+	}
+
+	return readingListPosts(list).remove(c)
+}
+
+// ReorderReadingList sets the order of the posts in a reading list. The body
+// lists post IDs in the wanted order; posts that are left out keep their
+// relative order after the listed ones.
+func ReorderReadingList(c *fiber.Ctx) error {
+	list, ok, err := ownedReadingList(c)
+	if !ok {
+		return err
+	}
+
+	return readingListPosts(list).reorder(c)
+}
+
+// findReadingList loads a reading list by its URL parameter. It returns a
+// non-zero status and a message when the list can't be loaded.
+func findReadingList(param string) (structures.ReadingList, int, string) {
+	var list structures.ReadingList
+	status, message := findCollection(param, &list, "reading list")
+	return list, status, message
+}
+
+// ownedReadingList loads the reading list named in the URL and checks that it
+// belongs to the current user. When ok is false the response has already
+// been written and err must be returned by the handler.
+func ownedReadingList(c *fiber.Ctx) (list structures.ReadingList, ok bool, err error) {
+	ok, err = ownedCollection(c, "listID", &list, "reading list", func() string { return list.UserID })
+	return list, ok, err
+}
+
+// attachBookmarks marks the given posts the user has bookmarked.
+func attachBookmarks(posts []structures.Blog, userID string) {
+	if userID == "" || len(posts) == 0 {
+		return
+	}
+	ids := make([]uint, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	var saved []uint
+	db.DB.Model(&structures.Bookmark{}).Where("user_id = ? AND post_id IN ?", userID, ids).Pluck("post_id", &saved)
+	bookmarked := map[uint]bool{}
+	for _, id := range saved {
+		bookmarked[id] = true
+	}
+	for i := range posts {
+		posts[i].Bookmarked = bookmarked[posts[i].Id]
+	}
+}
+
+// deleteBookmarks removes a deleted post from every bookmark and reading
+// list.
+func deleteBookmarks(postID uint) {
+	db.DB.Where("post_id = ?", postID).Delete(&structures.Bookmark{})
+	db.DB.Where("post_id = ?", postID).Delete(&structures.ReadingListItem{})
+}
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// InviteAuthor invites a user to co-author a post. Only owners of the post
+// can invite; the body gives the user_id and the role, editor by default.
+func InviteAuthor(c *fiber.Ctx) error {
+	post, ok, err := ownedPost(c)
+	if !ok {
+		return err
+	}
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+
+	var inviteData struct {
+		UserID uint   `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := c.BodyParser(&inviteData); err != nil || inviteData.UserID == 0 {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid invitation payload",
+		})
+	}
+	if inviteData.Role == "" {
+		inviteData.Role = structures.AuthorRoleEditor
+	}
+	if !structures.ValidAuthorRole(inviteData.Role) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid author role",
+		})
+	}
+
+	var invitee structures.User
+	if err := db.DB.Where("id = ?", inviteData.UserID).First(&invitee).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+	inviteeID := strconv.Itoa(int(invitee.Id))
+	if inviteeID == post.UserID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "User already owns this post",
+		})
+	}
+
+	var author structures.PostAuthor
+	if err := db.DB.Where("post_id = ? AND user_id = ?", post.Id, inviteeID).First(&author).Error; err == nil {
+		c.Status(fiber.StatusConflict)
+		return c.JSON(fiber.Map{
+			"message": "User is already an author or invited",
+			"author":  author,
+		})
+	}
+
+	author = structures.PostAuthor{
+		PostID:    post.Id,
+		UserID:    inviteeID,
+		Role:      inviteData.Role,
+		Status:    structures.AuthorPending,
+		InvitedBy: userID,
+	}
+	if err := db.DB.Create(&author).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to invite author",
+		})
+	}
+	author.User = invitee
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation sent",
+		"author":  author,
+	})
+}
+
+// PostAuthors lists the authors of a post. Owners also see pending
+// invitations.
+func PostAuthors(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+	var post structures.Blog
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if err := db.DB.Where("id = ?", postID).Preload("User").First(&post).Error; err != nil || !canReadPost(post, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	posts := []structures.Blog{post}
+	attachAuthors(posts)
+	response := fiber.Map{
+		"authors": posts[0].Authors,
+	}
+	if postRole(post, userID) == structures.AuthorRoleOwner {
+		var pending []structures.PostAuthor
+		db.DB.Where("post_id = ? AND status = ?", post.Id, structures.AuthorPending).Preload("User").Order("created_at").Find(&pending)
+		response["invitations"] = pending
+	}
+	return c.JSON(response)
+}
+
+// RemoveAuthor removes a co-author from a post or revokes their invitation.
+// Owners can remove anyone but the original writer; co-authors can remove
+// themselves.
+func RemoveAuthor(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var post structures.Blog
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	target := c.Params("userID")
+	if target != userID && postRole(post, userID) != structures.AuthorRoleOwner {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Only owners can remove other authors",
+		})
+	}
+	if target == post.UserID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "The original author can't be removed",
+		})
+	}
+
+	result := db.DB.Where("post_id = ? AND user_id = ?", post.Id, target).Delete(&structures.PostAuthor{})
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to remove author",
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User is not an author of this post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Author removed",
+	})
+}
+
+// MyInvitations lists the pending co-author invitations of the current user.
+func MyInvitations(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var invitations []structures.PostAuthor
+	if err := db.DB.Where("user_id = ? AND status = ?", userID, structures.AuthorPending).
+		Preload("Post.User").Order("created_at desc").Find(&invitations).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve invitations",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"invitations": invitations,
+	})
+}
+
+// AcceptInvitation makes the current user a co-author of the post they were
+// invited to.
+func AcceptInvitation(c *fiber.Ctx) error {
+	invitation, ok, err := ownInvitation(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Model(&invitation).Update("status", structures.AuthorAccepted).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to accept invitation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation accepted",
+		"author":  invitation,
+	})
+}
+
+// DeclineInvitation turns down a co-author invitation.
+func DeclineInvitation(c *fiber.Ctx) error {
+	invitation, ok, err := ownInvitation(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Delete(&invitation).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to decline invitation",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation declined",
+	})
+}
+
+// ownInvitation loads the pending invitation named in the URL and checks
+// that it was sent to the current user. When ok is false the response has
+// already been written and err must be returned by the handler.
+func ownInvitation(c *fiber.Ctx) (invitation structures.PostAuthor, ok bool, err error) {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, parseErr := tools.Parsejwt(cookie)
+	if parseErr != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return invitation, false, c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	err = db.DB.Where("id = ? AND user_id = ? AND status = ?", c.Params("inviteID"), userID, structures.AuthorPending).First(&invitation).Error
+	if err != nil {
+		status, message := fiber.StatusInternalServerError, "Internal server error"
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status, message = fiber.StatusNotFound, "Invitation not found"
+		}
+		c.Status(status)
+		return invitation, false, c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+	return invitation, true, nil
+}
+
+// ownedPost loads the post named in the URL and checks that the current
+// user is one of its owners. When ok is false the response has already been
+// written and err must be returned by the handler.
+func ownedPost(c *fiber.Ctx) (post structures.Blog, ok bool, err error) {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, parseErr := tools.Parsejwt(cookie)
+	if parseErr != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	if postRole(post, userID) != structures.AuthorRoleOwner {
+		c.Status(fiber.StatusForbidden)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Only owners of the post can manage its authors",
+		})
+	}
+	return post, true, nil
+}
+
+// postRole returns the role of the user on a post, or "" when they are not
+// one of its authors. The original writer is always an owner.
+func postRole(post structures.Blog, userID string) string {
+	if userID == "" {
+		return ""
+	}
+	if post.UserID == userID {
+		return structures.AuthorRoleOwner
+	}
+	var author structures.PostAuthor
+	if err := db.DB.Where("post_id = ? AND user_id = ? AND status = ?", post.Id, userID, structures.AuthorAccepted).First(&author).Error; err != nil {
+		return ""
+	}
+	return author.Role
+}
+
+// attachAuthors fills in the author list of the given posts: the original
+// writer followed by the accepted co-authors in the order they joined.
+func attachAuthors(posts []structures.Blog) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uint, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	var coauthors []structures.PostAuthor
+	db.DB.Where("post_id IN ? AND status = ?", ids, structures.AuthorAccepted).Preload("User").Order("created_at").Find(&coauthors)
+	byPost := map[uint][]structures.PostAuthor{}
+	for _, author := range coauthors {
+		byPost[author.PostID] = append(byPost[author.PostID], author)
+	}
+
+	// Writers whose User wasn't preloaded are loaded in one query
+	var missing []string
+	for _, post := range posts {
+		if post.User.Id == 0 {
+			missing = append(missing, post.UserID)
+		}
+	}
+	users := map[string]structures.User{}
+	if len(missing) > 0 {
+		var found []structures.User
+		db.DB.Where("id IN ?", missing).Find(&found)
+		for _, user := range found {
+			users[strconv.Itoa(int(user.Id))] = user
+		}
+	}
+
+	for i, post := range posts {
+		writer := post.User
+		if writer.Id == 0 {
+			writer = users[post.UserID]
+		}
+		authors := []structures.PostAuthor{{
+			PostID: post.Id,
+			UserID: post.UserID,
+			Role:   structures.AuthorRoleOwner,
+			Status: structures.AuthorAccepted,
+			User:   writer,
+		}}
+		posts[i].Authors = append(authors, byPost[post.Id]...)
+	}
+}
+
+// deleteAuthors removes the co-authors and invitations of a deleted post.
+func deleteAuthors(postID uint) {
+	db.DB.Where("post_id = ?", postID).Delete(&structures.PostAuthor{})
+}
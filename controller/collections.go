@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// postCollection is an ordered set of posts kept in a membership table with
+// a position column: the posts of a series or of a reading list.
+type postCollection struct {
+	model  interface{} // a row of the membership table, e.g. &structures.SeriesPost{}
+	column string      // the column of that table naming the collection
+	id     uint
+	name   string // what the collection is called in messages
+}
+
+func seriesPosts(series structures.Series) postCollection {
+	return postCollection{model: &structures.SeriesPost{}, column: "series_id", id: series.ID, name: "series"}
+}
+
+func readingListPosts(list structures.ReadingList) postCollection {
+	return postCollection{model: &structures.ReadingListItem{}, column: "list_id", id: list.ID, name: "reading list"}
+}
+
+// nextPosition returns the position of a post appended to the collection.
+func (pc postCollection) nextPosition() int {
+	var maxPosition int
+	db.DB.Model(pc.model).Where(pc.column+" = ?", pc.id).
+		Select("COALESCE(MAX(position), 0)").Scan(&maxPosition)
+	return maxPosition + 1
+}
+
+// remove takes the post named in the URL out of the collection.
+func (pc postCollection) remove(c *fiber.Ctx) error {
+	result := db.DB.Where(pc.column+" = ? AND post_id = ?", pc.id, c.Params("id")).Delete(pc.model)
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to remove post from " + pc.name,
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Post not in " + pc.name,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post removed from " + pc.name,
+	})
+}
+
+// reorder sets the order of the posts in the collection. The body lists
+// post IDs in the wanted order; posts that are left out keep their relative
+// order after the listed ones.
+func (pc postCollection) reorder(c *fiber.Ctx) error {
+	var orderData struct {
+		PostIDs []uint `json:"post_ids"`
+	}
+	if err := c.BodyParser(&orderData); err != nil || len(orderData.PostIDs) == 0 {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid order payload",
+		})
+	}
+
+	var items []struct {
+		ID     uint
+		PostID uint
+	}
+	db.DB.Model(pc.model).Select("id, post_id").Where(pc.column+" = ?", pc.id).Order("position").Scan(&items)
+
+	byPost := map[uint]uint{}
+	for _, item := range items {
+		byPost[item.PostID] = item.ID
+	}
+	ordered := make([]uint, 0, len(items))
+	seen := map[uint]bool{}
+	for _, postID := range orderData.PostIDs {
+		itemID, ok := byPost[postID]
+		if !ok {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Post " + strconv.Itoa(int(postID)) + " is not in the " + pc.name,
+			})
+		}
+		if seen[postID] {
+			continue
+		}
+		seen[postID] = true
+		ordered = append(ordered, itemID)
+	}
+	for _, item := range items {
+		if !seen[item.PostID] {
+			ordered = append(ordered, item.ID)
+		}
+	}
+
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i, itemID := range ordered {
+			if err := tx.Model(pc.model).Where("id = ?", itemID).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to reorder " + pc.name,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": capitalize(pc.name) + " reordered",
+	})
+}
+
+// findCollection loads a series or reading list into dest by its URL
+// parameter. It returns a non-zero status and a message when it can't be
+// loaded.
+func findCollection(param string, dest interface{}, name string) (int, string) {
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		return fiber.StatusBadRequest, "Invalid " + name + " ID"
+	}
+	if err := db.DB.Where("id = ?", id).Preload("User").First(dest).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.StatusNotFound, capitalize(name) + " not found"
+		}
+		return fiber.StatusInternalServerError, "Internal server error"
+	}
+	return 0, ""
+}
+
+// ownedCollection loads the series or reading list named by the URL
+// parameter into dest, and checks that owner, called once it is loaded,
+// is the current user. When ok is false the response has already been
+// written and err must be returned by the handler.
+func ownedCollection(c *fiber.Ctx, param string, dest interface{}, name string, owner func() string) (ok bool, err error) {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, parseErr := tools.Parsejwt(cookie)
+	if parseErr != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return false, c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	status, message := findCollection(c.Params(param), dest, name)
+	if status == 0 && owner() != userID {
+		status, message = fiber.StatusNotFound, capitalize(name)+" not found"
+	}
+	if status != 0 {
+		c.Status(status)
+		return false, c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+	return true, nil
+}
+
+// collectedPost loads the post named in the URL, to be added to a
+// collection. When ok is false the response has already been written and
+// err must be returned by the handler.
+func collectedPost(c *fiber.Ctx) (post structures.Blog, ok bool, err error) {
+	postID, parseErr := strconv.Atoi(c.Params("id"))
+	if parseErr != nil {
+		c.Status(fiber.StatusBadRequest)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+
+	if err := db.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+		status, message := fiber.StatusInternalServerError, "Internal server error"
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status, message = fiber.StatusNotFound, "Blog post not found"
+		}
+		c.Status(status)
+		return post, false, c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+	return post, true, nil
+}
+
+// capitalize upper-cases the first letter of an ASCII noun.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
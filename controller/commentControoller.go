@@ -8,6 +8,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/spam"
 	"github.com/aizeresalim/final/structures"
 	"github.com/aizeresalim/final/tools"
 	"gorm.io/gorm"
@@ -57,6 +58,19 @@ func CreateComment(c *fiber.Ctx) error {
 			"message": "Internal server error",
 		})
 	}
+	if !canReadPost(blogPost, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	if ok, message := mayComment(blogPost, userID); !ok {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
 
 	// Create new comment object
 	comment := structures.Comment{
@@ -64,24 +78,85 @@ func CreateComment(c *fiber.Ctx) error {
 		PostID:   uint(postID),
 		Content:  commentData.Content,
 		DateTime: time.Now(),
+		Status:   structures.CommentApproved,
+	}
+	if holdComment(blogPost, userID) {
+		comment.Status = structures.CommentPending
+	}
+	if verdict := screenSpam(spam.Content{Kind: spam.KindComment, UserID: userID, Body: comment.Content}); verdict.Spam {
+		comment.Status, comment.HeldReason = structures.CommentPending, heldReason(verdict)
+	}
+
+	// Replies hang under a visible comment of the same post that wasn't
+	// deleted
+	if commentData.ParentID != nil {
+		var parent structures.Comment
+		err := db.DB.Scopes(visibleComments(userID)).Where("id = ? AND post_id = ?", *commentData.ParentID, postID).First(&parent).Error
+		if err != nil || parent.Deleted {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Parent comment not found",
+			})
+		}
+		parent, err = replyParent(parent)
+		if err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Internal server error",
+			})
+		}
+		comment.ParentID = &parent.ID
+		comment.Depth = parent.Depth + 1
 	}
 
 	// Save comment to db
-	if err := db.DB.Create(&comment).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		// Held replies only count once approved
+		if comment.ParentID == nil || comment.Status != structures.CommentApproved {
+			return nil
+		}
+		return tx.Model(&structures.Comment{}).Where("id = ?", *comment.ParentID).
+			UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error
+	})
+	if err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to create comment",
 		})
 	}
 
+	if comment.Status == structures.CommentPending {
+		c.Status(fiber.StatusAccepted)
+		return c.JSON(fiber.Map{
+			"message": "Your comment is awaiting moderation",
+			"comment": comment,
+		})
+	}
+	notifyComment(comment, blogPost)
+	notifyMentions(comment.Content, userID, blogPost, &comment.ID)
+	publishComment(comment)
 	return c.JSON(fiber.Map{
 		"message": "Comment created successfully",
 		"comment": comment,
 	})
 }
 
-// UpdateComment updates an existing comment.
+// UpdateComment updates an existing comment. Authors can edit their
+// comments within the edit window, moderators at any time; the replaced
+// version is kept in the comment's history.
 func UpdateComment(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+	userID := strconv.Itoa(int(user.Id))
+
 	// Parse comment ID from URL parameter
 	commentID, err := strconv.Atoi(c.Params("commentID"))
 	if err != nil {
@@ -116,16 +191,83 @@ func UpdateComment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Update comment content
+	if comment.Deleted {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Comment not found",
+		})
+	}
+	if comment.UserID != userID && !user.IsModerator() {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "You can only edit your own comments",
+		})
+	}
+	if window := commentEditWindow(); window > 0 && !user.IsModerator() && time.Since(comment.DateTime) > window {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Comments can only be edited for " + strconv.Itoa(int(window.Minutes())) + " minutes after posting",
+		})
+	}
+	// Locked and disabled threads are frozen for everyone but moderators
+	var post structures.Blog
+	db.DB.Where("id = ?", comment.PostID).First(&post)
+	if (post.CommentAccess == structures.CommentsLocked || post.CommentAccess == structures.CommentsDisabled) && !user.IsModerator() {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Comments are " + post.CommentAccess + " on this post",
+		})
+	}
+	if updatedComment.Content == comment.Content {
+		return c.JSON(fiber.Map{
+			"message": "Comment unchanged",
+			"comment": comment,
+		})
+	}
+
+	// Update comment content, keeping the version it replaces
+	revision := structures.CommentRevision{CommentID: comment.ID, Content: comment.Content, EditedBy: userID}
+	editedAt := time.Now()
 	comment.Content = updatedComment.Content
+	comment.Edited, comment.EditedAt = true, &editedAt
+
+	// Edits are screened again; an approved comment turning into spam goes
+	// back to the queue
+	wasApproved := comment.Status == structures.CommentApproved
+	if verdict := screenSpam(spam.Content{Kind: spam.KindComment, UserID: comment.UserID, ID: comment.ID, Body: comment.Content}); verdict.Spam {
+		comment.Status, comment.HeldReason = structures.CommentPending, heldReason(verdict)
+	}
 
 	// Save updated comment to db
-	if err := db.DB.Save(&comment).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(&comment).Error; err != nil {
+			return err
+		}
+		if !wasApproved || comment.Status == structures.CommentApproved || comment.ParentID == nil {
+			return nil
+		}
+		return tx.Model(&structures.Comment{}).Where("id = ?", *comment.ParentID).
+			UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error
+	})
+	if err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to update comment",
 		})
 	}
+	if comment.Status == structures.CommentPending {
+		c.Status(fiber.StatusAccepted)
+		return c.JSON(fiber.Map{
+			"message": "Your comment is awaiting moderation",
+			"comment": comment,
+		})
+	}
+	if comment.Status == structures.CommentApproved && post.Id != 0 {
+		notifyMentions(comment.Content, comment.UserID, post, &comment.ID)
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "Comment updated successfully",
@@ -159,8 +301,26 @@ func DeleteComment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete comment from db
-	if err := db.DB.Delete(&comment).Error; err != nil {
+	// Writers can delete their comments, moderators and authors of the post
+	// any comment on it
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+	var post structures.Blog
+	db.DB.Where("id = ?", comment.PostID).First(&post)
+	if comment.UserID != strconv.Itoa(int(user.Id)) && !canModerate(post, user) {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "You can only delete your own comments",
+		})
+	}
+
+	// Delete comment from db, leaving a tombstone when it has replies
+	if err := removeComment(comment); err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to delete comment",
@@ -172,7 +332,31 @@ func DeleteComment(c *fiber.Ctx) error {
 	})
 }
 
+// CommentHistory lists the versions of a comment, oldest first, ending
+// with the current one. Only those who can moderate the comment see it.
+func CommentHistory(c *fiber.Ctx) error {
+	comment, _, ok, err := moderatedComment(c)
+	if !ok {
+		return err
+	}
+
+	var revisions []structures.CommentRevision
+	if err := db.DB.Where("comment_id = ?", comment.ID).Order("id").Find(&revisions).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve comment history",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"comment":   comment,
+		"revisions": revisions,
+	})
+}
+
 func ReadComments(c *fiber.Ctx) error {
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+
 	// Parse blog post ID from URL parameter
 	postID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -196,18 +380,50 @@ func ReadComments(c *fiber.Ctx) error {
 			"message": "Internal server error",
 		})
 	}
+	if !canReadPost(blogPost, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	// Disabled threads show no comments at all
+	canPost, _ := mayComment(blogPost, userID)
+	if blogPost.CommentAccess == structures.CommentsDisabled {
+		return c.JSON(fiber.Map{
+			"message":        "Comments are disabled on this post",
+			"comments":       []structures.Comment{},
+			"total":          0,
+			"comment_access": blogPost.CommentAccess,
+			"can_comment":    false,
+		})
+	}
 
 	// Retrieve comments associated with the blog post
 	var comments []structures.Comment
-	if err := db.DB.Where("post_id = ?", postID).Find(&comments).Error; err != nil {
+	if err := db.DB.Scopes(visibleComments(userID)).Where("post_id = ?", postID).Order("id").Find(&comments).Error; err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to retrieve comments",
 		})
 	}
 
+	attachCommentReactions(comments, userID)
+	attachCommentMentions(c, comments)
+	hideTombstones(comments)
+
+	// Threads are nested by default; ?view=flat lists them in reading order
+	// with their depth and path instead
+	threads := buildThreads(comments)
+	if c.Query("view") == "flat" {
+		threads = flattenThreads(threads)
+	}
+
 	return c.JSON(fiber.Map{
-		"message":  "Comments retrieved successfully",
-		"comments": comments,
+		"message":        "Comments retrieved successfully",
+		"comments":       threads,
+		"total":          len(comments),
+		"comment_access": blogPost.CommentAccess,
+		"can_comment":    canPost && userID != "",
 	})
 }
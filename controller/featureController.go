@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPinnedPosts caps the number of posts pinned to a profile.
+const maxPinnedPosts = 3
+
+// PinPost pins a post to the profile of its writer. Only owners of the post
+// can pin it.
+func PinPost(c *fiber.Ctx) error {
+	post, ok, err := pinnablePost(c)
+	if !ok {
+		return err
+	}
+	if post.PinnedAt != nil {
+		return c.JSON(fiber.Map{
+			"message": "Post already pinned",
+		})
+	}
+
+	var pinned int64
+	db.DB.Model(&structures.Blog{}).Where("user_id = ? AND pinned_at IS NOT NULL", post.UserID).Count(&pinned)
+	if pinned >= maxPinnedPosts {
+		c.Status(fiber.StatusConflict)
+		return c.JSON(fiber.Map{
+			"message": "At most " + strconv.Itoa(maxPinnedPosts) + " posts can be pinned, unpin one first",
+		})
+	}
+
+	// UpdateColumn keeps UpdatedAt, pinning is not an edit
+	if err := db.DB.Model(&post).UpdateColumn("pinned_at", time.Now()).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to pin post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post pinned",
+	})
+}
+
+// UnpinPost removes a post from its writer's profile pins.
+func UnpinPost(c *fiber.Ctx) error {
+	post, ok, err := pinnablePost(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Model(&post).UpdateColumn("pinned_at", nil).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to unpin post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post unpinned",
+	})
+}
+
+// FeaturePost features a post site-wide. The body gives either "until" as
+// an RFC 3339 time or "days" from now; FEATURED_DAYS (default 7) applies
+// when neither is set. Only admins can feature posts, and only public ones.
+func FeaturePost(c *fiber.Ctx) error {
+	post, ok, err := adminPost(c)
+	if !ok {
+		return err
+	}
+	if post.Visibility != structures.VisibilityPublic || post.Status != structures.PostApproved {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Only public posts can be featured",
+		})
+	}
+
+	var featureData struct {
+		Until *time.Time `json:"until"`
+		Days  int        `json:"days"`
+	}
+	c.BodyParser(&featureData)
+	until := time.Now().AddDate(0, 0, tools.EnvInt("FEATURED_DAYS", 7))
+	switch {
+	case featureData.Until != nil:
+		until = *featureData.Until
+	case featureData.Days > 0:
+		until = time.Now().AddDate(0, 0, featureData.Days)
+	}
+	if !until.After(time.Now()) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Featured expiry must be in the future",
+		})
+	}
+
+	if err := db.DB.Model(&post).UpdateColumn("featured_until", until).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to feature post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":        "Post featured",
+		"featured_until": until,
+	})
+}
+
+// UnfeaturePost stops featuring a post before its expiry.
+func UnfeaturePost(c *fiber.Ctx) error {
+	post, ok, err := adminPost(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Model(&post).UpdateColumn("featured_until", nil).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to unfeature post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post no longer featured",
+	})
+}
+
+// FeaturedPosts lists the posts currently featured, the ones expiring last
+// first.
+func FeaturedPosts(c *fiber.Ctx) error {
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+
+	var posts []structures.Blog
+	if err := db.DB.Scopes(listedPosts(userID)).
+		Where("blogs.featured_until > ?", time.Now()).
+		Preload("User").
+		Order("blogs.featured_until desc").
+		Find(&posts).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve featured posts",
+		})
+	}
+	decoratePosts(posts, userID)
+	listFields(c, posts)
+
+	return c.JSON(fiber.Map{
+		"data": posts,
+	})
+}
+
+// featuredFirst orders a blogs query with the currently featured posts
+// first, then by ID. It sets the whole ORDER BY clause since gorm drops
+// plain Order columns next to an order expression.
+func featuredFirst(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "blogs.featured_until > ? DESC, blogs.id",
+		Vars:               []interface{}{time.Now()},
+		WithoutParentheses: true,
+	}})
+}
+
+// attachFeatured tells which of the given posts are featured right now.
+func attachFeatured(posts []structures.Blog) {
+	now := time.Now()
+	for i, post := range posts {
+		posts[i].Featured = post.FeaturedUntil != nil && post.FeaturedUntil.After(now)
+	}
+}
+
+// pinnablePost loads the post named in the URL and checks that the current
+// user owns it. When ok is false the response has already been written and
+// err must be returned by the handler.
+func pinnablePost(c *fiber.Ctx) (post structures.Blog, ok bool, err error) {
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	if postRole(post, userID) != structures.AuthorRoleOwner {
+		c.Status(fiber.StatusForbidden)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Only owners of the post can pin it",
+		})
+	}
+	return post, true, nil
+}
+
+// adminPost loads the post named in the URL and checks that the current
+// user is an admin. When ok is false the response has already been written
+// and err must be returned by the handler.
+func adminPost(c *fiber.Ctx) (post structures.Blog, ok bool, err error) {
+	user, userErr := currentUser(c)
+	if userErr != nil || !user.IsAdmin() {
+		c.Status(fiber.StatusForbidden)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Only admins can feature posts",
+		})
+	}
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return post, false, c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	return post, true, nil
+}
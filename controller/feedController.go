@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/feed"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// SiteFeed serves the feed of every public post.
+func SiteFeed(c *fiber.Ctx) error {
+	query := db.DB.Model(&structures.Blog{})
+	return serveFeed(c, "site", query, feed.Feed{
+		Title:       tools.EnvString("SITE_NAME", "Blog"),
+		Description: "Latest posts",
+		Link:        siteURL(c) + "/allPost",
+	})
+}
+
+// AuthorFeed serves the feed of the public posts of one author.
+func AuthorFeed(c *fiber.Ctx) error {
+	authorID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+
+	var author structures.User
+	if err := db.DB.Where("id = ?", authorID).First(&author).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	name := displayName(author.FirstName, author.LastName)
+	query := db.DB.Model(&structures.Blog{}).Where("blogs.user_id = ?", authorID)
+	return serveFeed(c, "author:"+strconv.Itoa(authorID), query, feed.Feed{
+		Title:       name + " - " + tools.EnvString("SITE_NAME", "Blog"),
+		Description: "Latest posts by " + name,
+		Link:        profileURL(c, strconv.Itoa(authorID)),
+	})
+}
+
+// TagFeed serves the feed of the public posts carrying a tag.
+func TagFeed(c *fiber.Ctx) error {
+	// Slugs of non-Latin tags arrive percent-encoded
+	slug, _ := url.PathUnescape(c.Params("slug"))
+	var tag structures.Tag
+	if err := db.DB.Where("slug = ?", slug).First(&tag).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Tag not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	query := db.DB.Model(&structures.Blog{}).
+		Where("blogs.id IN (?)", db.DB.Table("post_tags").Select("blog_id").Where("tag_id = ?", tag.ID))
+	return serveFeed(c, "tag:"+tag.Slug, query, feed.Feed{
+		Title:       "#" + tag.Name + " - " + tools.EnvString("SITE_NAME", "Blog"),
+		Description: "Latest posts tagged " + tag.Name,
+		Link:        siteURL(c) + "/allPost",
+	})
+}
+
+// serveFeed renders the public posts matched by query as a feed in the
+// format named by the :format URL parameter. It answers conditional requests
+// with 304 when nothing changed since the client's copy.
+func serveFeed(c *fiber.Ctx, scope string, query *gorm.DB, f feed.Feed) error {
+	format := c.Params("format")
+	if !feed.Valid(format) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Unknown feed format, use rss, atom or json",
+		})
+	}
+	query = query.Scopes(publishedPosts)
+
+	// Validators come from a cheap aggregate so unchanged feeds aren't rendered
+	var state struct {
+		Updated *time.Time
+		Total   int64
+	}
+	query.Session(&gorm.Session{}).Select("MAX(blogs.updated_at) as updated, COUNT(*) as total").Scan(&state)
+	if state.Updated != nil {
+		f.Updated = *state.Updated
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%d", format, scope, f.Updated.UnixNano(), state.Total)))
+	c.Set(fiber.HeaderETag, `W/"`+hex.EncodeToString(sum[:8])+`"`)
+	if !f.Updated.IsZero() {
+		c.Set(fiber.HeaderLastModified, f.Updated.UTC().Format(http.TimeFormat))
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	if c.Fresh() {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	var posts []structures.Blog
+	limit := tools.EnvInt("FEED_SIZE", 20)
+	if err := query.Session(&gorm.Session{}).Preload("User").Order("blogs.created_at desc").Limit(limit).Find(&posts).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to build feed",
+		})
+	}
+	attachTags(posts)
+
+	f.FeedURL = siteURL(c) + c.OriginalURL()
+	f.ID = feedID("feed/" + scope)
+	for _, post := range posts {
+		item := feed.Item{
+			ID:        feedID("post/" + strconv.Itoa(int(post.Id))),
+			Title:     post.Title,
+			Link:      postURL(c, post.Id),
+			Summary:   tools.Truncate(tools.PlainText(post.Desc), 280),
+			Content:   tools.RenderMarkdown(post.Desc),
+			Author:    displayName(post.User.FirstName, post.User.LastName),
+			Published: post.CreatedAt,
+			Updated:   post.UpdatedAt,
+		}
+		for _, tag := range post.Tags {
+			item.Tags = append(item.Tags, tag.Name)
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	body, err := feed.Render(f, format)
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to build feed",
+		})
+	}
+	c.Set(fiber.HeaderContentType, feed.ContentType(format))
+	return c.Send(body)
+}
+
+// feedNamespace is the namespace of feed and entry IDs. It is fixed, so
+// IDs don't depend on the host a feed is fetched from.
+var feedNamespace = uuid.MustParse("7c7eeae6-04d0-4b67-a4b0-a9bc02600b7b")
+
+// feedID returns a stable URN for a feed or an entry, derived from its name
+// only so it never changes when posts are edited or the site moves.
+func feedID(name string) string {
+	return uuid.NewSHA1(feedNamespace, []byte(name)).URN()
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// Followers lists the users following the user named in the URL, most
+// recent first.
+func Followers(c *fiber.Ctx) error {
+	return followList(c, "followed_user_id", "follower_id")
+}
+
+// Following lists the users the user named in the URL follows, most recent
+// first.
+func Following(c *fiber.Ctx) error {
+	return followList(c, "follower_id", "followed_user_id")
+}
+
+// followList lists the follows whose column matches the user named in the
+// URL, showing the user on the other side of each. Every entry tells
+// whether the current user follows that user.
+func followList(c *fiber.Ctx, column, other string) error {
+	var user structures.User
+	viewerID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&user).Error; err != nil || !canSeeProfile(user, viewerID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	var total int64
+	var follows []structures.Follow
+	query := db.DB.Model(&structures.Follow{}).Where(column+" = ?", user.Id)
+	query.Session(&gorm.Session{}).Count(&total)
+	if err := query.Order("id desc").Offset(offset).Limit(limit).Find(&follows).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve follows",
+		})
+	}
+
+	ids := make([]uint, len(follows))
+	for i, follow := range follows {
+		ids[i] = follow.FollowerID
+		if other == "followed_user_id" {
+			ids[i] = follow.FollowedUserID
+		}
+	}
+	users := map[uint]structures.User{}
+	if len(ids) > 0 {
+		var found []structures.User
+		db.DB.Where("id IN ?", ids).Find(&found)
+		for _, u := range found {
+			users[u.Id] = u
+		}
+	}
+	followed := followedAmong(viewerID, ids)
+
+	data := []fiber.Map{}
+	for i, follow := range follows {
+		u, ok := users[ids[i]]
+		if !ok {
+			continue
+		}
+		data = append(data, fiber.Map{
+			"id":              u.Id,
+			"first_name":      u.FirstName,
+			"last_name":       u.LastName,
+			"handle":          u.Handle,
+			"follower_count":  u.FollowerCount,
+			"following_count": u.FollowingCount,
+			"post_count":      u.PostCount,
+			"following":       followed[u.Id],
+			"followed_at":     follow.CreatedAt,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// isFollowing tells whether the viewer follows the user. Anonymous viewers
+// follow no one.
+func isFollowing(viewerID string, userID uint) bool {
+	return followedAmong(viewerID, []uint{userID})[userID]
+}
+
+// followedAmong returns which of the users the viewer follows.
+func followedAmong(viewerID string, userIDs []uint) map[uint]bool {
+	followed := map[uint]bool{}
+	if viewerID == "" || len(userIDs) == 0 {
+		return followed
+	}
+	var ids []uint
+	db.DB.Model(&structures.Follow{}).
+		Where("follower_id = ? AND followed_user_id IN ?", viewerID, userIDs).
+		Pluck("followed_user_id", &ids)
+	for _, id := range ids {
+		followed[id] = true
+	}
+	return followed
+}
+
+// countFollow moves the follower and following counters of both sides of a
+// follow by delta.
+func countFollow(tx *gorm.DB, follow structures.Follow, delta int) error {
+	if err := tx.Model(&structures.User{}).Where("id = ?", follow.FollowedUserID).
+		UpdateColumn("follower_count", gorm.Expr("follower_count + ?", delta)).Error; err != nil {
+		return err
+	}
+	return tx.Model(&structures.User{}).Where("id = ?", follow.FollowerID).
+		UpdateColumn("following_count", gorm.Expr("following_count + ?", delta)).Error
+}
+
+// countPost moves the post counter of the user by delta.
+func countPost(tx *gorm.DB, userID string, delta int) error {
+	return tx.Model(&structures.User{}).Where("id = ?", userID).
+		UpdateColumn("post_count", gorm.Expr("post_count + ?", delta)).Error
+}
+
+// deleteFollows removes the follows of a user being deleted, taking them
+// off the counters of the users on the other side.
+func deleteFollows(userID string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&structures.User{}).
+			Where("id IN (?)", tx.Model(&structures.Follow{}).Select("followed_user_id").Where("follower_id = ?", userID)).
+			UpdateColumn("follower_count", gorm.Expr("follower_count - 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&structures.User{}).
+			Where("id IN (?)", tx.Model(&structures.Follow{}).Select("follower_id").Where("followed_user_id = ?", userID)).
+			UpdateColumn("following_count", gorm.Expr("following_count - 1")).Error; err != nil {
+			return err
+		}
+		return tx.Where("follower_id = ? OR followed_user_id = ?", userID, userID).Delete(&structures.Follow{}).Error
+	})
+}
@@ -3,8 +3,13 @@
 package controller
 
 import (
-	"github.com/gofiber/fiber/v2"
 	"math/rand"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
 )
 
 var letters = []rune("abcdefghijklmnopqrsuvwxyz")
@@ -18,6 +23,16 @@ func randLetter(n int) string {
 }
 
 func UploadImage(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
 	// Parse multipart form
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -30,13 +45,14 @@ func UploadImage(c *fiber.Ctx) error {
 	// Get files from the form
 	files := form.File["image"]
 	fileNames := make([]string, len(files))
+	uploaded := make([]structures.Media, len(files))
 
 	// Iterate over each file
 	for i, file := range files {
 		// Generate a unique file name
 		fileName := randLetter(5) + "-" + file.Filename
 		// Save the file
-		if err := c.SaveFile(file, "./uploads/"+fileName); err != nil {
+		if err := c.SaveFile(file, tools.UploadDir+fileName); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":   "Saving file failed",
 				"message": err.Error(),
@@ -44,10 +60,126 @@ func UploadImage(c *fiber.Ctx) error {
 		}
 		// Store the file name
 		fileNames[i] = fileName
+
+		// Record the upload so it can be attached to posts
+		media := structures.Media{
+			UserID:       userID,
+			FileName:     fileName,
+			OriginalName: file.Filename,
+			ContentType:  file.Header.Get("Content-Type"),
+			Size:         file.Size,
+		}
+		media.Width, media.Height = tools.ImageSize(tools.UploadDir + fileName)
+		if err := db.DB.Create(&media).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":   "Saving media failed",
+				"message": err.Error(),
+			})
+		}
+		media.URL = tools.MediaURL(media.FileName)
+		uploaded[i] = media
 	}
 
 	// Return file names of uploaded files
 	return c.JSON(fiber.Map{
 		"fileNames": fileNames,
+		"media":     uploaded,
+	})
+}
+
+// MyMedia lists the media uploaded by the current user, newest first.
+func MyMedia(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var media []structures.Media
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&media).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve media",
+		})
+	}
+	for i := range media {
+		media[i].URL = tools.MediaURL(media[i].FileName)
+	}
+
+	return c.JSON(fiber.Map{
+		"media": media,
 	})
 }
+
+// validateMedia checks that every given media item exists and was uploaded
+// by one of the given users.
+func validateMedia(ids []uint, userIDs ...string) bool {
+	unique := map[uint]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	if len(unique) == 0 {
+		return true
+	}
+	var count int64
+	db.DB.Model(&structures.Media{}).Where("id IN ? AND user_id IN ?", ids, userIDs).Count(&count)
+	return int(count) == len(unique)
+}
+
+// setPostMedia replaces the inline media of a post, keeping the given order.
+func setPostMedia(postID uint, ids []uint) error {
+	if err := db.DB.Where("post_id = ?", postID).Delete(&structures.PostMedia{}).Error; err != nil {
+		return err
+	}
+	seen := map[uint]bool{}
+	for i, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		link := structures.PostMedia{PostID: postID, MediaID: id, Position: i}
+		if err := db.DB.Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachMedia resolves the cover image and inline media of a post.
+func attachMedia(post *structures.Blog) {
+	if post.CoverMediaID != nil {
+		var cover structures.Media
+		if err := db.DB.Where("id = ?", *post.CoverMediaID).First(&cover).Error; err == nil {
+			cover.URL = tools.MediaURL(cover.FileName)
+			post.Cover = &cover
+		}
+	}
+
+	var links []structures.PostMedia
+	db.DB.Where("post_id = ?", post.Id).Order("position").Find(&links)
+	if len(links) == 0 {
+		return
+	}
+	ids := make([]uint, len(links))
+	for i, link := range links {
+		ids[i] = link.MediaID
+	}
+	var media []structures.Media
+	db.DB.Where("id IN ?", ids).Find(&media)
+	byID := map[uint]structures.Media{}
+	for _, m := range media {
+		m.URL = tools.MediaURL(m.FileName)
+		byID[m.ID] = m
+	}
+	post.MediaIDs = ids
+	post.Media = post.Media[:0]
+	for _, id := range ids {
+		if m, ok := byID[id]; ok {
+			post.Media = append(post.Media, m)
+		}
+	}
+}
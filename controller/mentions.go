@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/mention"
+	"github.com/aizeresalim/final/structures"
+)
+
+// notifyMentions sends a mention notification to every user mentioned in
+// text who can read the post. commentID is set for mentions in comments.
+// Mentions already notified are skipped by notify, so edits only reach the
+// newly mentioned users.
+func notifyMentions(text, authorID string, post structures.Blog, commentID *uint) {
+	for _, user := range mention.Resolve(text) {
+		userID := strconv.Itoa(int(user.Id))
+		if !canReadPost(post, userID) {
+			continue
+		}
+		postID := post.Id
+		sendNotification(structures.Notification{
+			UserID:    userID,
+			ActorID:   authorID,
+			Type:      structures.NotificationMention,
+			PostID:    &postID,
+			CommentID: commentID,
+		})
+	}
+}
+
+// mentionsIn lists the users among the given ones mentioned in text, in
+// order of appearance.
+func mentionsIn(c *fiber.Ctx, text string, users map[string]structures.User) []structures.Mention {
+	var mentions []structures.Mention
+	for _, handle := range mention.Handles(text) {
+		if user, ok := users[handle]; ok {
+			userID := strconv.Itoa(int(user.Id))
+			mentions = append(mentions, structures.Mention{Handle: user.Handle, UserID: userID, URL: profileURL(c, userID)})
+		}
+	}
+	return mentions
+}
+
+// attachMentions fills in the mentions of a post body.
+func attachMentions(c *fiber.Ctx, post *structures.Blog) {
+	post.Mentions = mentionsIn(c, post.Desc, mention.Resolve(post.Desc))
+}
+
+// attachCommentMentions fills in the mentions of the given comments,
+// resolving the handles of all of them at once.
+func attachCommentMentions(c *fiber.Ctx, comments []structures.Comment) {
+	var handles []string
+	for _, comment := range comments {
+		if strings.Contains(comment.Content, "@") {
+			handles = append(handles, mention.Handles(comment.Content)...)
+		}
+	}
+	users := mention.Users(handles)
+	if len(users) == 0 {
+		return
+	}
+	for i, comment := range comments {
+		comments[i].Mentions = mentionsIn(c, comment.Content, users)
+	}
+}
+
+// linkMentions rewrites the mentions in a Markdown body as links to the
+// profiles of the users mentioned.
+func linkMentions(c *fiber.Ctx, text string) string {
+	return mention.Link(text, func(user structures.User) string {
+		return profileURL(c, strconv.Itoa(int(user.Id)))
+	})
+}
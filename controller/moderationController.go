@@ -0,0 +1,510 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/related"
+	"github.com/aizeresalim/final/spam"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// ModerationQueue lists the held comments the current user can moderate,
+// oldest first: every held comment for moderators, and the ones on their
+// own posts for authors. ?post_id= narrows the queue to one post.
+func ModerationQueue(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+	userID := strconv.Itoa(int(user.Id))
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	query := db.DB.Model(&structures.Comment{}).Where("comments.status = ?", structures.CommentPending)
+	if !user.IsModerator() {
+		authored := db.DB.Model(&structures.Blog{}).Select("id").
+			Where("user_id = ?", userID).Or("id IN (?)", coauthoredPosts(userID))
+		query = query.Where("comments.post_id IN (?)", authored)
+	}
+	if postID := c.Query("post_id"); postID != "" {
+		query = query.Where("comments.post_id = ?", postID)
+	}
+
+	var total int64
+	var comments []structures.Comment
+	query.Session(&gorm.Session{}).Count(&total)
+	if err := query.Preload("User").Order("comments.id").Offset(offset).Limit(limit).Find(&comments).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve moderation queue",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": comments,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// ApproveComment publishes a held comment. The spam classifier learns from
+// it as ham when a moderator approves it.
+func ApproveComment(c *fiber.Ctx) error {
+	comment, post, ok, err := moderatedComment(c)
+	if !ok {
+		return err
+	}
+	user, _ := currentUser(c)
+
+	if err := approveComment(comment); err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to approve comment",
+		})
+	}
+	if comment.Status == structures.CommentPending {
+		if user.IsModerator() {
+			trainSpam(comment.Content, false)
+		}
+		notifyComment(comment, post)
+		notifyMentions(comment.Content, comment.UserID, post, &comment.ID)
+		comment.Status = structures.CommentApproved
+		publishComment(comment)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Comment approved",
+	})
+}
+
+// RejectComment keeps a held comment hidden for good. The spam classifier
+// learns from it as spam when a moderator rejects it.
+func RejectComment(c *fiber.Ctx) error {
+	comment, _, ok, err := moderatedComment(c)
+	if !ok {
+		return err
+	}
+	user, _ := currentUser(c)
+
+	if err := rejectComment(comment); err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to reject comment",
+		})
+	}
+	if comment.Status != structures.CommentRejected && user.IsModerator() {
+		trainSpam(comment.Content, true)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Comment rejected",
+	})
+}
+
+// BanCommenter rejects a comment and bans its author from commenting. Post
+// authors ban from their own posts; moderators ban site-wide unless the body
+// sets "scope" to "author".
+func BanCommenter(c *fiber.Ctx) error {
+	comment, post, ok, err := moderatedComment(c)
+	if !ok {
+		return err
+	}
+	user, _ := currentUser(c)
+	userID := strconv.Itoa(int(user.Id))
+	if comment.UserID == userID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "You can't ban yourself",
+		})
+	}
+
+	var banData struct {
+		Scope string `json:"scope"`
+	}
+	c.BodyParser(&banData)
+	ban := structures.CommentBan{UserID: comment.UserID, AuthorID: post.UserID, BannedBy: userID}
+	if user.IsModerator() && banData.Scope != "author" {
+		ban.AuthorID = ""
+	}
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND author_id = ?", ban.UserID, ban.AuthorID).FirstOrCreate(&ban).Error; err != nil {
+			return err
+		}
+		// Everything else the user has waiting in the same scope goes too
+		pending := tx.Model(&structures.Comment{}).Where("user_id = ? AND status = ?", ban.UserID, structures.CommentPending)
+		if ban.AuthorID != "" {
+			pending = pending.Where("post_id IN (?)", tx.Model(&structures.Blog{}).Select("id").Where("user_id = ?", ban.AuthorID))
+		}
+		return pending.Update("status", structures.CommentRejected).Error
+	})
+	if err == nil && comment.Status == structures.CommentApproved {
+		err = rejectComment(comment)
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to ban user",
+		})
+	}
+	if comment.Status != structures.CommentRejected && user.IsModerator() {
+		trainSpam(comment.Content, true)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User banned from commenting",
+		"ban":     ban,
+	})
+}
+
+// PostQueue lists the posts held as spam, oldest first. Only moderators
+// review held posts.
+func PostQueue(c *fiber.Ctx) error {
+	if _, ok, err := requireModerator(c); !ok {
+		return err
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	var total int64
+	var posts []structures.Blog
+	query := db.DB.Model(&structures.Blog{}).Where("status = ?", structures.PostPending)
+	query.Session(&gorm.Session{}).Count(&total)
+	if err := query.Preload("User").Order("id").Offset(offset).Limit(limit).Find(&posts).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve moderation queue",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": posts,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// ApprovePost publishes a post held as spam and trains the classifier with
+// it as ham.
+func ApprovePost(c *fiber.Ctx) error {
+	return decidePost(c, structures.PostApproved)
+}
+
+// RejectPost keeps a held post hidden from everyone but its authors and
+// trains the classifier with it as spam.
+func RejectPost(c *fiber.Ctx) error {
+	return decidePost(c, structures.PostRejected)
+}
+
+// decidePost moves the post named in the URL to the given status.
+func decidePost(c *fiber.Ctx, status string) error {
+	if _, ok, err := requireModerator(c); !ok {
+		return err
+	}
+	var post structures.Blog
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == structures.PostApproved {
+		updates["held_reason"] = ""
+	}
+	if err := db.DB.Model(&post).UpdateColumns(updates).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to moderate post",
+		})
+	}
+	if post.Status != status {
+		trainSpam(post.Title+"\n"+post.Desc, status == structures.PostRejected)
+	}
+	if status == structures.PostApproved {
+		post.Status = status
+		notifyMentions(post.Desc, post.UserID, post, nil)
+		publishPost(post)
+	}
+	related.Invalidate(post.Id)
+
+	return c.JSON(fiber.Map{
+		"message": "Post " + status,
+	})
+}
+
+// ListBans lists the comment bans the current user placed, or every ban for
+// moderators.
+func ListBans(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	query := db.DB.Preload("User").Order("created_at desc")
+	if !user.IsModerator() {
+		query = query.Where("author_id = ?", strconv.Itoa(int(user.Id)))
+	}
+	var bans []structures.CommentBan
+	if err := query.Find(&bans).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve bans",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"bans": bans,
+	})
+}
+
+// LiftBan removes a comment ban. Authors can lift the bans on their posts,
+// moderators any ban.
+func LiftBan(c *fiber.Ctx) error {
+	user, err := currentUser(c)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	query := db.DB.Where("id = ?", c.Params("banID"))
+	if !user.IsModerator() {
+		query = query.Where("author_id = ?", strconv.Itoa(int(user.Id)))
+	}
+	result := query.Delete(&structures.CommentBan{})
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to lift ban",
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Ban not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Ban lifted",
+	})
+}
+
+// screenSpam runs the spam checks on content about to be saved.
+// Moderators are trusted and never screened.
+func screenSpam(content spam.Content) spam.Verdict {
+	var user structures.User
+	if err := db.DB.Where("id = ?", content.UserID).First(&user).Error; err == nil && user.IsModerator() {
+		return spam.Verdict{}
+	}
+	return spam.Check(content)
+}
+
+// heldReason is the reason stored with content held by a spam verdict.
+func heldReason(verdict spam.Verdict) string {
+	return tools.Truncate(verdict.Reason(), 250)
+}
+
+// trainSpam feeds a moderator decision to the spam classifier. Decisions of
+// post authors moderating their own threads are not fed to it, as the
+// classifier is shared by the whole site. Failing to learn from a decision
+// doesn't undo it.
+func trainSpam(text string, isSpam bool) {
+	if err := spam.Train(text, isSpam); err != nil {
+		log.Println("Error training spam classifier:", err)
+	}
+}
+
+// requireModerator loads the current user and checks they are a moderator.
+// When ok is false the response has already been written and err must be
+// returned by the handler.
+func requireModerator(c *fiber.Ctx) (user structures.User, ok bool, err error) {
+	user, userErr := currentUser(c)
+	if userErr != nil || !user.IsModerator() {
+		c.Status(fiber.StatusForbidden)
+		return user, false, c.JSON(fiber.Map{
+			"message": "Only moderators can do this",
+		})
+	}
+	return user, true, nil
+}
+
+// commentModeration returns the moderation mode of a post: its own setting,
+// else the site's COMMENT_MODERATION (default open).
+func commentModeration(post structures.Blog) string {
+	if structures.ValidModeration(post.CommentModeration) {
+		return post.CommentModeration
+	}
+	if mode := tools.EnvString("COMMENT_MODERATION", structures.ModerationOpen); structures.ValidModeration(mode) {
+		return mode
+	}
+	return structures.ModerationOpen
+}
+
+// holdComment tells whether a new comment by the user on the post must wait
+// for moderation. Authors of the post are never held. Under first-held
+// moderation, a user is trusted once a comment of theirs was approved on a
+// post by the same writer; comments on posts they co-author don't count, as
+// those are never held.
+func holdComment(post structures.Blog, userID string) bool {
+	if postRole(post, userID) != "" {
+		return false
+	}
+	switch commentModeration(post) {
+	case structures.ModerationAllHeld:
+		return true
+	case structures.ModerationFirstHeld:
+		var approved int64
+		db.DB.Model(&structures.Comment{}).
+			Where("user_id = ? AND status = ?", userID, structures.CommentApproved).
+			Where("post_id IN (?)", db.DB.Model(&structures.Blog{}).Select("id").Where("user_id = ?", post.UserID)).
+			Where("post_id NOT IN (?)", db.DB.Model(&structures.PostAuthor{}).Select("post_id").
+				Where("user_id = ? AND status = ?", userID, structures.AuthorAccepted)).
+			Count(&approved)
+		return approved == 0
+	}
+	return false
+}
+
+// commentBanned tells whether the user is banned from commenting on the
+// post, site-wide or by its writer.
+func commentBanned(post structures.Blog, userID string) bool {
+	var count int64
+	db.DB.Model(&structures.CommentBan{}).Where("user_id = ? AND author_id IN ?", userID, []string{"", post.UserID}).Count(&count)
+	return count > 0
+}
+
+// mayComment tells whether the user may comment on the post and, when not,
+// why. Comments must not be closed by moderation, the post's comment access
+// must let the user in, and the user must not be banned.
+func mayComment(post structures.Blog, userID string) (bool, string) {
+	if commentModeration(post) == structures.ModerationClosed {
+		return false, "Comments are closed on this post"
+	}
+	if ok, message := canComment(post, userID); !ok {
+		return false, message
+	}
+	if userID != "" && commentBanned(post, userID) {
+		return false, "You are banned from commenting on this post"
+	}
+	return true, ""
+}
+
+// visibleComments limits a comments query to approved comments, plus the
+// held ones written by the user.
+func visibleComments(userID string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if userID == "" {
+			return tx.Where("comments.status = ?", structures.CommentApproved)
+		}
+		return tx.Where("comments.status = ? OR (comments.status = ? AND comments.user_id = ?)",
+			structures.CommentApproved, structures.CommentPending, userID)
+	}
+}
+
+// approveComment publishes a comment and counts it as a reply of its
+// parent.
+func approveComment(comment structures.Comment) error {
+	if comment.Status == structures.CommentApproved {
+		return nil
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Update("status", structures.CommentApproved).Error; err != nil {
+			return err
+		}
+		if comment.ParentID == nil {
+			return nil
+		}
+		return tx.Model(&structures.Comment{}).Where("id = ?", *comment.ParentID).
+			UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error
+	})
+}
+
+// rejectComment hides a comment, taking it out of its parent's replies when
+// it was published.
+func rejectComment(comment structures.Comment) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Update("status", structures.CommentRejected).Error; err != nil {
+			return err
+		}
+		if comment.Status != structures.CommentApproved || comment.ParentID == nil {
+			return nil
+		}
+		return tx.Model(&structures.Comment{}).Where("id = ?", *comment.ParentID).
+			UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error
+	})
+}
+
+// canModerate tells whether the user may moderate comments on the post:
+// moderators everywhere, authors on their own posts.
+func canModerate(post structures.Blog, user structures.User) bool {
+	return user.IsModerator() || postRole(post, strconv.Itoa(int(user.Id))) != ""
+}
+
+// moderatedComment loads the comment named in the URL along with its post
+// and checks that the current user may moderate it. When ok is false the
+// response has already been written and err must be returned by the
+// handler.
+func moderatedComment(c *fiber.Ctx) (comment structures.Comment, post structures.Blog, ok bool, err error) {
+	user, userErr := currentUser(c)
+	if userErr != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return comment, post, false, c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	err = db.DB.Where("id = ?", c.Params("commentID")).First(&comment).Error
+	if err == nil {
+		err = db.DB.Where("id = ?", comment.PostID).First(&post).Error
+	}
+	if err != nil {
+		status, message := fiber.StatusInternalServerError, "Internal server error"
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			status, message = fiber.StatusNotFound, "Comment not found"
+		}
+		c.Status(status)
+		return comment, post, false, c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+	if !canModerate(post, user) {
+		c.Status(fiber.StatusForbidden)
+		return comment, post, false, c.JSON(fiber.Map{
+			"message": "You can't moderate comments on this post",
+		})
+	}
+	return comment, post, true, nil
+}
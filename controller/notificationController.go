@@ -0,0 +1,266 @@
+package controller
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/notify"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// MyNotifications lists the notifications of the current user, newest
+// first. ?unread=true keeps the unread ones and ?type= one type.
+func MyNotifications(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	query := db.DB.Model(&structures.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+
+	var total int64
+	var notifications []structures.Notification
+	query.Session(&gorm.Session{}).Count(&total)
+	if err := query.Preload("Actor").Order("id desc").Offset(offset).Limit(limit).Find(&notifications).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   notifications,
+		"unread": unreadNotifications(userID),
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// UnreadNotifications returns the number of unread notifications of the
+// current user, in total and per type.
+func UnreadNotifications(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var rows []struct {
+		Type  string
+		Count int64
+	}
+	db.DB.Model(&structures.Notification{}).
+		Select("type, COUNT(*) as count").
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Group("type").
+		Scan(&rows)
+	byType := map[string]int64{}
+	var total int64
+	for _, row := range rows {
+		byType[row.Type] = row.Count
+		total += row.Count
+	}
+
+	return c.JSON(fiber.Map{
+		"unread":  total,
+		"by_type": byType,
+	})
+}
+
+// ReadNotification marks one notification of the current user as read.
+func ReadNotification(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var notification structures.Notification
+	if err := db.DB.Where("id = ? AND user_id = ?", c.Params("notificationID"), userID).First(&notification).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Notification not found",
+		})
+	}
+	if notification.ReadAt == nil {
+		if err := db.DB.Model(&notification).Update("read_at", time.Now()).Error; err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to mark notification as read",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notification marked as read",
+		"unread":  unreadNotifications(userID),
+	})
+}
+
+// ReadAllNotifications marks every notification of the current user as
+// read, or only the ones of the type given in ?type=.
+func ReadAllNotifications(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	query := db.DB.Model(&structures.Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	result := query.Update("read_at", time.Now())
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to mark notifications as read",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Notifications marked as read",
+		"marked":  result.RowsAffected,
+		"unread":  unreadNotifications(userID),
+	})
+}
+
+// NotificationPreferences returns which notification types are on for the
+// current user.
+func NotificationPreferences(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"preferences": notify.Preferences(userID),
+	})
+}
+
+// UpdateNotificationPreferences turns notification types on or off. The
+// body maps types to true or false; types left out keep their setting.
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var prefs map[string]bool
+	if err := c.BodyParser(&prefs); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid preferences payload",
+		})
+	}
+	for t := range prefs {
+		if !structures.ValidNotificationType(t) {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Unknown notification type " + strconv.Quote(t),
+			})
+		}
+	}
+	for t, enabled := range prefs {
+		if err := notify.SetPreference(userID, t, enabled); err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to update preferences",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"message":     "Preferences updated",
+		"preferences": notify.Preferences(userID),
+	})
+}
+
+// unreadNotifications counts the unread notifications of a user.
+func unreadNotifications(userID string) int64 {
+	var count int64
+	db.DB.Model(&structures.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// sendNotification delivers a notification, logging failures: they never
+// undo what the user did.
+func sendNotification(n structures.Notification) {
+	if err := notify.Send(n); err != nil {
+		log.Println("Error sending notification:", err)
+	}
+}
+
+// notifyComment tells the authors of the post about a new comment and the
+// writer of the parent comment about a reply. Writers of the parent who are
+// also authors of the post only get the reply.
+func notifyComment(comment structures.Comment, post structures.Blog) {
+	postID, commentID := post.Id, comment.ID
+	replyTo := ""
+	if comment.ParentID != nil {
+		var parent structures.Comment
+		if err := db.DB.Where("id = ?", *comment.ParentID).First(&parent).Error; err == nil && !parent.Deleted {
+			replyTo = parent.UserID
+			sendNotification(structures.Notification{
+				UserID:    parent.UserID,
+				ActorID:   comment.UserID,
+				Type:      structures.NotificationReply,
+				PostID:    &postID,
+				CommentID: &commentID,
+			})
+		}
+	}
+
+	authors := []string{post.UserID}
+	var coauthors []string
+	db.DB.Model(&structures.PostAuthor{}).Where("post_id = ? AND status = ?", post.Id, structures.AuthorAccepted).Pluck("user_id", &coauthors)
+	for _, authorID := range append(authors, coauthors...) {
+		if authorID == replyTo {
+			continue
+		}
+		sendNotification(structures.Notification{
+			UserID:    authorID,
+			ActorID:   comment.UserID,
+			Type:      structures.NotificationComment,
+			PostID:    &postID,
+			CommentID: &commentID,
+		})
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/aizeresalim/final/analytics"
 	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/related"
+	"github.com/aizeresalim/final/spam"
 	"github.com/aizeresalim/final/structures"
 	"github.com/aizeresalim/final/tools"
 	"gorm.io/gorm"
@@ -30,13 +34,81 @@ func CreatePost(c *fiber.Ctx) error {
 	// Set the UserID field of the blogpost with the retrieved user ID
 	blogpost.UserID = userID
 
+	if blogpost.Visibility == "" {
+		blogpost.Visibility = structures.VisibilityPublic
+	}
+	if !structures.ValidVisibility(blogpost.Visibility) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid visibility",
+		})
+	}
+	if blogpost.CommentModeration != "" && !structures.ValidModeration(blogpost.CommentModeration) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid comment moderation mode",
+		})
+	}
+	if blogpost.CommentAccess != "" && !structures.ValidCommentAccess(blogpost.CommentAccess) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid comment access",
+		})
+	}
+
+	// Authors can only attach media they uploaded themselves
+	if !validateMedia(append(blogpost.MediaIDs, coverID(blogpost)...), userID) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Unknown media or media uploaded by another user",
+		})
+	}
+
+	// Tags are attached by name once the post exists; pins and features are
+	// set through their own endpoints
+	blogpost.Tags = nil
+	blogpost.PinnedAt, blogpost.FeaturedUntil = nil, nil
+	blogpost.Excerpt, blogpost.WordCount, blogpost.ReadingMinutes = tools.Summarize(blogpost.Desc)
+
+	// Posts that look like spam wait for a moderator
+	blogpost.Status, blogpost.HeldReason = structures.PostApproved, ""
+	if verdict := screenSpam(spam.Content{Kind: spam.KindPost, UserID: userID, Title: blogpost.Title, Body: blogpost.Desc}); verdict.Spam {
+		blogpost.Status, blogpost.HeldReason = structures.PostPending, heldReason(verdict)
+	}
+
 	// Create the blog post in the db
-	if err := db.DB.Create(&blogpost).Error; err != nil {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&blogpost).Error; err != nil {
+			return err
+		}
+		return countPost(tx, blogpost.UserID, 1)
+	})
+	if err != nil {
 		fmt.Println("Error creating post:", err)
 		return c.Status(500).JSON(fiber.Map{
 			"message": "Error creating post",
 		})
 	}
+	if err := setPostMedia(blogpost.Id, blogpost.MediaIDs); err != nil {
+		fmt.Println("Error attaching media:", err)
+		return c.Status(500).JSON(fiber.Map{
+			"message": "Error attaching media",
+		})
+	}
+	if err := setPostTags(&blogpost, blogpost.TagNames); err != nil {
+		fmt.Println("Error attaching tags:", err)
+		return c.Status(500).JSON(fiber.Map{
+			"message": "Error attaching tags",
+		})
+	}
+	related.Invalidate(blogpost.Id)
+
+	// Held posts notify the users they mention once approved
+	if blogpost.Status == structures.PostApproved {
+		notifyMentions(blogpost.Desc, userID, blogpost, nil)
+		publishPost(blogpost)
+	}
+	if blogpost.Status == structures.PostPending {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Your post is awaiting moderation",
+		})
+	}
 
 	// Return a success response if the blog post was created successfully
 	return c.JSON(fiber.Map{
@@ -44,29 +116,93 @@ func CreatePost(c *fiber.Ctx) error {
 	})
 }
 
+// AllPost lists the posts the user may see. ?order=featured puts the
+// posts featured right now first.
 func AllPost(c *fiber.Ctx) error {
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit := 5
 	offset := (page - 1) * limit
 	var total int64
 	var getblog []structures.Blog
-	db.DB.Preload("User").Offset(offset).Limit(limit).Find(&getblog)
-	db.DB.Model(&structures.Blog{}).Count(&total)
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	query := db.DB.Scopes(listedPosts(userID))
+	if c.Query("order") == "featured" {
+		query = query.Scopes(featuredFirst)
+	}
+	query.Preload("User").Offset(offset).Limit(limit).Find(&getblog)
+	db.DB.Model(&structures.Blog{}).Scopes(listedPosts(userID)).Count(&total)
+	decoratePosts(getblog, userID)
+	listFields(c, getblog)
 	return c.JSON(fiber.Map{
 		"data": getblog,
 		"meta": fiber.Map{
 			"total":     total,
 			"page":      page,
-			"last_page": math.Ceil(float64(int(total) / limit)),
+			"last_page": lastPage(total, limit),
 		},
 	})
 
 }
 
+// decoratePosts fills in the fields of the given posts that depend on the
+// user making the request.
+func decoratePosts(posts []structures.Blog, userID string) {
+	attachAuthors(posts)
+	attachFeatured(posts)
+	attachTags(posts)
+	attachPostReactions(posts, userID)
+	attachBookmarks(posts, userID)
+}
+
+// listFields prepares posts for a list response: bodies are left out in
+// favour of the excerpt unless ?fields= includes desc. Posts saved before
+// excerpts existed get theirs computed on the fly until the summaries
+// command stores them.
+func listFields(c *fiber.Ctx, posts []structures.Blog) {
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		if strings.TrimSpace(field) == "desc" {
+			return
+		}
+	}
+	for i, post := range posts {
+		if post.Excerpt == "" && post.Desc != "" {
+			posts[i].Excerpt, posts[i].WordCount, posts[i].ReadingMinutes = tools.Summarize(post.Desc)
+		}
+		posts[i].Desc = ""
+	}
+}
+
+// coverID returns the cover media ID of a post as a slice, for validation.
+func coverID(post structures.Blog) []uint {
+	if post.CoverMediaID == nil {
+		return nil
+	}
+	return []uint{*post.CoverMediaID}
+}
+
+// lastPage returns the number of pages needed to show total items.
+func lastPage(total int64, limit int) float64 {
+	return math.Ceil(float64(total) / float64(limit))
+}
+
 func DetailPost(c *fiber.Ctx) error {
 	id, _ := strconv.Atoi(c.Params("id"))
 	var blogpost structures.Blog
 	db.DB.Where("id=?", id).Preload("User").First(&blogpost)
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if blogpost.Id == 0 || !canReadPost(blogpost, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	posts := []structures.Blog{blogpost}
+	decoratePosts(posts, userID)
+	blogpost = posts[0]
+	attachMedia(&blogpost)
+	attachSeries(&blogpost, userID)
+	attachMentions(c, &blogpost)
+	recordView(c, blogpost.Id, userID)
 	return c.JSON(fiber.Map{
 		"data": blogpost,
 	})
@@ -74,15 +210,113 @@ func DetailPost(c *fiber.Ctx) error {
 }
 
 func UpdatePost(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
 	id, _ := strconv.Atoi(c.Params("id"))
 	blog := structures.Blog{
 		Id: uint(id),
 	}
 
 	if err := c.BodyParser(&blog); err != nil {
-		fmt.Println("Unable to parse body")
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid post payload",
+		})
+	}
+	// The post to update is the one in the URL, whatever id the body carries
+	blog.Id = uint(id)
+	if blog.Visibility != "" && !structures.ValidVisibility(blog.Visibility) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid visibility",
+		})
+	}
+	if blog.CommentModeration != "" && !structures.ValidModeration(blog.CommentModeration) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid comment moderation mode",
+		})
+	}
+	if blog.CommentAccess != "" && !structures.ValidCommentAccess(blog.CommentAccess) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Invalid comment access",
+		})
+	}
+
+	var existing structures.Blog
+	if err := db.DB.Where("id = ?", id).First(&existing).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	// Owners and editors can edit; only owners can change who sees the post
+	role := postRole(existing, userID)
+	if role == "" {
+		return c.Status(403).JSON(fiber.Map{
+			"message": "You are not an author of this post",
+		})
+	}
+	if role != structures.AuthorRoleOwner && blog.Visibility != "" && blog.Visibility != existing.Visibility {
+		return c.Status(403).JSON(fiber.Map{
+			"message": "Only owners can change the visibility of a post",
+		})
+	}
+	blog.UserID = ""
+	blog.PinnedAt, blog.FeaturedUntil = nil, nil
+	blog.Excerpt, blog.WordCount, blog.ReadingMinutes = "", 0, 0
+	if blog.Desc != "" {
+		blog.Excerpt, blog.WordCount, blog.ReadingMinutes = tools.Summarize(blog.Desc)
+	}
+
+	// Edits are screened again, so spam can't be slipped into an approved post
+	blog.Status, blog.HeldReason = "", ""
+	if (blog.Title != "" || blog.Desc != "") && existing.Status == structures.PostApproved {
+		content := spam.Content{Kind: spam.KindPost, UserID: userID, ID: existing.Id, Title: existing.Title, Body: existing.Desc}
+		if blog.Title != "" {
+			content.Title = blog.Title
+		}
+		if blog.Desc != "" {
+			content.Body = blog.Desc
+		}
+		if verdict := screenSpam(content); verdict.Spam {
+			blog.Status, blog.HeldReason = structures.PostPending, heldReason(verdict)
+		}
+	}
+
+	// Authors can only attach media they uploaded themselves
+	if !validateMedia(append(blog.MediaIDs, coverID(blog)...), existing.UserID, userID) {
+		return c.Status(400).JSON(fiber.Map{
+			"message": "Unknown media or media uploaded by another user",
+		})
 	}
+
+	blog.Tags = nil
 	db.DB.Model(&blog).Updates(blog)
+	if blog.TagNames != nil {
+		if err := setPostTags(&blog, blog.TagNames); err != nil {
+			fmt.Println("Error attaching tags:", err)
+			return c.Status(500).JSON(fiber.Map{
+				"message": "Error attaching tags",
+			})
+		}
+	}
+	if blog.MediaIDs != nil {
+		if err := setPostMedia(blog.Id, blog.MediaIDs); err != nil {
+			fmt.Println("Error attaching media:", err)
+			return c.Status(500).JSON(fiber.Map{
+				"message": "Error attaching media",
+			})
+		}
+	}
+	related.Invalidate(blog.Id)
+	if blog.Desc != "" && blog.Status != structures.PostPending {
+		var saved structures.Blog
+		if err := db.DB.Where("id = ?", blog.Id).First(&saved).Error; err == nil && saved.Status == structures.PostApproved {
+			notifyMentions(saved.Desc, userID, saved, nil)
+		}
+	}
+	if blog.Status == structures.PostPending {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "Your post is awaiting moderation",
+		})
+	}
 	return c.JSON(fiber.Map{
 		"message": "post updated successfully",
 	})
@@ -93,7 +327,10 @@ func UniquePost(c *fiber.Ctx) error {
 	cookie := c.Cookies("jwt")
 	id, _ := tools.Parsejwt(cookie)
 	var blog []structures.Blog
-	db.DB.Model(&blog).Where("user_id=?", id).Preload("User").Find(&blog)
+	db.DB.Model(&blog).Where("user_id=?", id).Or("id IN (?)", coauthoredPosts(id)).Preload("User").Find(&blog)
+	decoratePosts(blog, id)
+	attachViewCounts(blog)
+	listFields(c, blog)
 
 	return c.JSON(blog)
 
@@ -103,16 +340,60 @@ func DeletePost(c *fiber.Ctx) error {
 	blog := structures.Blog{
 		Id: uint(id),
 	}
-	deleteQuery := db.DB.Delete(&blog)
-	if errors.Is(deleteQuery.Error, gorm.ErrRecordNotFound) {
+	if err := db.DB.Where("id = ?", id).First(&blog).Error; err != nil {
 		c.Status(400)
 		return c.JSON(fiber.Map{
 			"message": "Opps!, record Not found",
 		})
 	}
 
+	// Only owners of the post, or admins, can delete it
+	user, _ := currentUser(c)
+	if postRole(blog, c.Locals("userID").(string)) != structures.AuthorRoleOwner && !user.IsAdmin() {
+		c.Status(403)
+		return c.JSON(fiber.Map{
+			"message": "Only owners of the post can delete it",
+		})
+	}
+
+	if err := removePost(blog); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(400)
+			return c.JSON(fiber.Map{
+				"message": "Opps!, record Not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to delete post",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"message": "post deleted successfully",
 	})
 
 }
+
+// removePost deletes a post along with everything attached to it:
+// reactions, bookmarks, co-authors and invitations, views, media, series
+// and tag links.
+func removePost(blog structures.Blog) error {
+	deleteQuery := db.DB.Delete(&blog)
+	if deleteQuery.Error != nil {
+		return deleteQuery.Error
+	}
+	if deleteQuery.RowsAffected > 0 {
+		countPost(db.DB, blog.UserID, -1)
+	}
+
+	deleteReactions(structures.ReactionTargetPost, blog.Id)
+	deleteBookmarks(blog.Id)
+	deleteAuthors(blog.Id)
+	analytics.DeletePost(blog.Id)
+	related.Forget(blog.Id)
+	db.DB.Where("post_id = ?", blog.Id).Delete(&structures.PostMedia{})
+	db.DB.Where("post_id = ?", blog.Id).Delete(&structures.SeriesPost{})
+	db.DB.Model(&blog).Association("Tags").Clear()
+	return nil
+}
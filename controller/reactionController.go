@@ -0,0 +1,332 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// ReactionTypes lists the configured reaction set.
+func ReactionTypes(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"types": tools.ReactionTypes(),
+	})
+}
+
+// TogglePostReaction adds the reaction of the current user to a post, or
+// removes it if it is already there.
+func TogglePostReaction(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+
+	// Check if the blog post exists
+	var blogPost structures.Blog
+	if err := db.DB.Where("id = ?", postID).First(&blogPost).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Blog post not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if !canReadPost(blogPost, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	return toggleReaction(c, structures.ReactionTargetPost, uint(postID))
+}
+
+// ToggleCommentReaction adds the reaction of the current user to a comment,
+// or removes it if it is already there.
+func ToggleCommentReaction(c *fiber.Ctx) error {
+	commentID, err := strconv.Atoi(c.Params("commentID"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid comment ID",
+		})
+	}
+
+	// Check if the comment exists and the user can see it
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	var comment structures.Comment
+	err = db.DB.Scopes(visibleComments(userID)).
+		Where("id = ? AND post_id = ? AND deleted = ?", commentID, c.Params("id"), false).First(&comment).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Comment not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	if !canReadPostID(comment.PostID, c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	return toggleReaction(c, structures.ReactionTargetComment, uint(commentID))
+}
+
+func toggleReaction(c *fiber.Ctx, targetType string, targetID uint) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	reactionType := strings.ToLower(c.Params("type"))
+	if !tools.IsReactionType(reactionType) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Unknown reaction type",
+			"types":   tools.ReactionTypes(),
+		})
+	}
+
+	// Remove the reaction if the user already left one of this type
+	var existing structures.Reaction
+	err = db.DB.Where("user_id = ? AND target_type = ? AND target_id = ? AND type = ?",
+		userID, targetType, targetID, reactionType).First(&existing).Error
+	reacted := false
+	switch {
+	case err == nil:
+		if err := db.DB.Delete(&existing).Error; err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to remove reaction",
+			})
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		reaction := structures.Reaction{
+			UserID:     userID,
+			TargetType: targetType,
+			TargetID:   targetID,
+			Type:       reactionType,
+		}
+		if err := db.DB.Create(&reaction).Error; err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to add reaction",
+			})
+		}
+		reacted = true
+	default:
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	counts, _ := reactionCounts(targetType, []uint{targetID})
+	return c.JSON(fiber.Map{
+		"reacted":   reacted,
+		"type":      reactionType,
+		"reactions": countsFor(counts, targetID),
+	})
+}
+
+// PostReactions lists the users who reacted to a post, optionally filtered by
+// ?type=.
+func PostReactions(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+	if !canReadPostID(uint(postID), c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	return listReactions(c, structures.ReactionTargetPost, uint(postID))
+}
+
+// CommentReactions lists the users who reacted to a comment, optionally
+// filtered by ?type=.
+func CommentReactions(c *fiber.Ctx) error {
+	commentID, err := strconv.Atoi(c.Params("commentID"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid comment ID",
+		})
+	}
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	var comment structures.Comment
+	err = db.DB.Scopes(visibleComments(userID)).
+		Where("id = ? AND post_id = ? AND deleted = ?", commentID, c.Params("id"), false).First(&comment).Error
+	if err != nil || !canReadPostID(comment.PostID, c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Comment not found",
+		})
+	}
+	return listReactions(c, structures.ReactionTargetComment, uint(commentID))
+}
+
+func listReactions(c *fiber.Ctx, targetType string, targetID uint) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	query := db.DB.Model(&structures.Reaction{}).Where("target_type = ? AND target_id = ?", targetType, targetID)
+	if reactionType := strings.ToLower(c.Query("type")); reactionType != "" {
+		if !tools.IsReactionType(reactionType) {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Unknown reaction type",
+			})
+		}
+		query = query.Where("type = ?", reactionType)
+	}
+
+	var total int64
+	var reactions []structures.Reaction
+	query.Count(&total)
+	if err := query.Preload("User").Order("created_at desc").Offset(offset).Limit(limit).Find(&reactions).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve reactions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": reactions,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// reactionCounts returns the per-type reaction counts for the given targets,
+// keyed by target ID.
+func reactionCounts(targetType string, ids []uint) (map[uint]map[string]int64, error) {
+	counts := map[uint]map[string]int64{}
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	var rows []struct {
+		TargetID uint
+		Type     string
+		Total    int64
+	}
+	err := db.DB.Model(&structures.Reaction{}).
+		Select("target_id, type, count(*) as total").
+		Where("target_type = ? AND target_id IN ?", targetType, ids).
+		Group("target_id, type").
+		Scan(&rows).Error
+	if err != nil {
+		return counts, err
+	}
+	for _, row := range rows {
+		if counts[row.TargetID] == nil {
+			counts[row.TargetID] = map[string]int64{}
+		}
+		counts[row.TargetID][row.Type] = row.Total
+	}
+	return counts, nil
+}
+
+// userReactions returns the reaction types the user left on the given
+// targets, keyed by target ID.
+func userReactions(userID, targetType string, ids []uint) map[uint][]string {
+	mine := map[uint][]string{}
+	if userID == "" || len(ids) == 0 {
+		return mine
+	}
+	var reactions []structures.Reaction
+	db.DB.Where("user_id = ? AND target_type = ? AND target_id IN ?", userID, targetType, ids).Find(&reactions)
+	for _, r := range reactions {
+		mine[r.TargetID] = append(mine[r.TargetID], r.Type)
+	}
+	return mine
+}
+
+// countsFor returns the counts of one target with every configured type
+// present, so clients don't have to deal with missing keys.
+func countsFor(counts map[uint]map[string]int64, id uint) map[string]int64 {
+	result := map[string]int64{}
+	for _, rt := range tools.ReactionTypes() {
+		result[rt.Name] = counts[id][rt.Name]
+	}
+	return result
+}
+
+// attachPostReactions fills in the reaction counts of the given posts and the
+// reactions the user left on them.
+func attachPostReactions(posts []structures.Blog, userID string) {
+	ids := make([]uint, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	counts, _ := reactionCounts(structures.ReactionTargetPost, ids)
+	mine := userReactions(userID, structures.ReactionTargetPost, ids)
+	for i := range posts {
+		posts[i].Reactions = countsFor(counts, posts[i].Id)
+		posts[i].MyReactions = mine[posts[i].Id]
+	}
+}
+
+// attachCommentReactions fills in the reaction counts of the given comments
+// and the reactions the user left on them.
+func attachCommentReactions(comments []structures.Comment, userID string) {
+	ids := make([]uint, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	counts, _ := reactionCounts(structures.ReactionTargetComment, ids)
+	mine := userReactions(userID, structures.ReactionTargetComment, ids)
+	for i := range comments {
+		comments[i].Reactions = countsFor(counts, comments[i].ID)
+		comments[i].MyReactions = mine[comments[i].ID]
+	}
+}
+
+// deleteReactions removes every reaction left on the given targets.
+func deleteReactions(targetType string, ids ...uint) {
+	if len(ids) == 0 {
+		return
+	}
+	db.DB.Where("target_type = ? AND target_id IN ?", targetType, ids).Delete(&structures.Reaction{})
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/realtime"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+// StreamComments streams the new comments on a post as Server-Sent Events.
+func StreamComments(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil || !canReadPostID(uint(postID), c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	return realtime.ServeSSE(c, realtime.Subscribe(realtime.PostTopic(uint(postID))))
+}
+
+// StreamEvents streams the private events of the current user as
+// Server-Sent Events: new posts from the users they follow and their
+// notifications. ?post_id= adds the new comments on that post, and can be
+// repeated.
+func StreamEvents(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	topics := []string{realtime.UserTopic(userID)}
+	for _, id := range c.Context().QueryArgs().PeekMulti("post_id") {
+		postID, err := strconv.Atoi(string(id))
+		if err != nil || !canReadPostID(uint(postID), c) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "Blog post not found",
+			})
+		}
+		topics = append(topics, realtime.PostTopic(uint(postID)))
+	}
+
+	return realtime.ServeSSE(c, realtime.Subscribe(topics...))
+}
+
+// Socket upgrades to a WebSocket carrying the same events as StreamEvents.
+// Clients follow the comments on a post by sending
+// {"action": "subscribe", "post_id": 1} and stop with "unsubscribe".
+func Socket(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	return realtime.Upgrade(c, func(conn *realtime.Conn) {
+		sub := realtime.Subscribe(realtime.UserTopic(userID))
+		realtime.ServeWebSocket(conn, sub, func(conn *realtime.Conn, message []byte) {
+			var command struct {
+				Action string `json:"action"`
+				PostID uint   `json:"post_id"`
+			}
+			if err := json.Unmarshal(message, &command); err != nil {
+				conn.WriteJSON(fiber.Map{"message": "Invalid command"})
+				return
+			}
+
+			switch command.Action {
+			case "subscribe":
+				var post structures.Blog
+				if err := db.DB.Where("id = ?", command.PostID).First(&post).Error; err != nil || !canReadPost(post, userID) {
+					conn.WriteJSON(fiber.Map{"message": "Blog post not found", "post_id": command.PostID})
+					return
+				}
+				sub.Add(realtime.PostTopic(command.PostID))
+			case "unsubscribe":
+				sub.Remove(realtime.PostTopic(command.PostID))
+			default:
+				conn.WriteJSON(fiber.Map{"message": "Unknown action, use subscribe or unsubscribe"})
+				return
+			}
+			conn.WriteJSON(fiber.Map{"message": "ok", "action": command.Action, "post_id": command.PostID})
+		})
+	})
+}
+
+// publishComment pushes a new comment to the readers following its post.
+func publishComment(comment structures.Comment) {
+	db.DB.Where("id = ?", comment.UserID).First(&comment.User)
+	realtime.Publish(realtime.PostTopic(comment.PostID), realtime.EventComment, comment)
+}
+
+// publishPost pushes a new post to the followers of its writer who can read
+// it. Unlisted and private posts are not pushed.
+func publishPost(post structures.Blog) {
+	if post.Status != structures.PostApproved ||
+		(post.Visibility != structures.VisibilityPublic && post.Visibility != structures.VisibilityFollowers) {
+		return
+	}
+	var followers []uint
+	db.DB.Model(&structures.Follow{}).Where("followed_user_id = ?", post.UserID).Pluck("follower_id", &followers)
+	if len(followers) == 0 {
+		return
+	}
+
+	db.DB.Where("id = ?", post.UserID).First(&post.User)
+	post.Desc = ""
+	for _, followerID := range followers {
+		realtime.Publish(realtime.UserTopic(strconv.Itoa(int(followerID))), realtime.EventPost, post)
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/related"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+// RelatedPosts returns up to ?limit= (default 5, at most 20) posts related
+// to a post, best match first.
+func RelatedPosts(c *fiber.Ctx) error {
+	postID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid post ID",
+		})
+	}
+	if !canReadPostID(uint(postID), c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "5"))
+	if limit < 1 || limit > 20 {
+		limit = 5
+	}
+	scored, err := related.For(uint(postID))
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to rank related posts",
+		})
+	}
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	ids := make([]uint, len(scored))
+	for i, s := range scored {
+		ids[i] = s.PostID
+	}
+	var found []structures.Blog
+	if len(ids) > 0 {
+		db.DB.Where("id IN ?", ids).Preload("User").Find(&found)
+	}
+	byID := map[uint]structures.Blog{}
+	for _, post := range found {
+		byID[post.Id] = post
+	}
+	posts := []structures.Blog{}
+	scores := []float64{}
+	for _, s := range scored {
+		// Rankings are cached, so skip posts deleted or hidden since
+		if post, ok := byID[s.PostID]; ok && post.Visibility == structures.VisibilityPublic && post.Status == structures.PostApproved {
+			posts = append(posts, post)
+			scores = append(scores, s.Score)
+		}
+	}
+
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	decoratePosts(posts, userID)
+	listFields(c, posts)
+	return c.JSON(fiber.Map{
+		"data":   posts,
+		"scores": scores,
+	})
+}
@@ -4,6 +4,12 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"html/template"
 	"log"
+	"strconv"
+	"time"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
 )
 
 type Templates struct {
@@ -11,6 +17,8 @@ type Templates struct {
 	login      *template.Template
 	allPost    *template.Template
 	createBlog *template.Template
+	post       *template.Template
+	profile    *template.Template
 }
 
 var TemplatesInstance *Templates
@@ -44,6 +52,19 @@ func LoadTemplates() {
 		log.Fatalf("Error parsing login template: %v", err)
 	}
 	TemplatesInstance.createBlog = creatBlogTmpl
+
+	// Public pages share the SEO meta tags defined in meta.tmpl
+	postTmpl, err := template.ParseFiles("ui/html/post.tmpl", "ui/html/meta.tmpl")
+	if err != nil {
+		log.Fatalf("Error parsing post template: %v", err)
+	}
+	TemplatesInstance.post = postTmpl
+
+	profileTmpl, err := template.ParseFiles("ui/html/profile.tmpl", "ui/html/meta.tmpl")
+	if err != nil {
+		log.Fatalf("Error parsing profile template: %v", err)
+	}
+	TemplatesInstance.profile = profileTmpl
 }
 
 func RenderRegisterPage(c *fiber.Ctx) error {
@@ -73,3 +94,110 @@ func RenderCreateBlogPage(c *fiber.Ctx) error {
 	// Render the login template
 	return TemplatesInstance.createBlog.Execute(c.Response().BodyWriter(), nil)
 }
+
+// pageMeta is rendered by the "meta" template into the canonical link and
+// the OpenGraph and Twitter card tags of a page. NoIndex pages ask crawlers
+// to keep them out of search results instead.
+type pageMeta struct {
+	SiteName    string
+	Type        string
+	Title       string
+	Description string
+	URL         string
+	Image       string
+	Author      string
+	Published   string
+	Modified    string
+	NoIndex     bool
+}
+
+func RenderPostPage(c *fiber.Ctx) error {
+	id, _ := strconv.Atoi(c.Params("id"))
+	var blogpost structures.Blog
+	db.DB.Where("id=?", id).Preload("User").First(&blogpost)
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if blogpost.Id == 0 || !canReadPost(blogpost, userID) {
+		return c.Status(fiber.StatusNotFound).SendString("Post not found")
+	}
+	posts := []structures.Blog{blogpost}
+	attachTags(posts)
+	blogpost = posts[0]
+	attachMedia(&blogpost)
+	recordView(c, blogpost.Id, userID)
+
+	meta := pageMeta{
+		SiteName:    tools.EnvString("SITE_NAME", "Blog"),
+		Type:        "article",
+		Title:       blogpost.Title,
+		Description: tools.Truncate(tools.PlainText(blogpost.Desc), 160),
+		URL:         postURL(c, blogpost.Id),
+		Author:      displayName(blogpost.User.FirstName, blogpost.User.LastName),
+		Published:   blogpost.CreatedAt.UTC().Format(time.RFC3339),
+		Modified:    blogpost.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if blogpost.Cover != nil {
+		meta.Image = absoluteURL(c, blogpost.Cover.URL)
+	}
+	// Only posts listed for everyone are indexed
+	if blogpost.Visibility != structures.VisibilityPublic || (blogpost.Status != structures.PostApproved && blogpost.Status != "") {
+		meta.NoIndex = true
+	}
+
+	// Comments follow the post's comment access: hidden when disabled, read
+	// only when locked or for non-followers
+	var comments []structures.Comment
+	if blogpost.CommentAccess != structures.CommentsDisabled {
+		db.DB.Scopes(visibleComments(userID)).Where("post_id = ?", blogpost.Id).Preload("User").Order("id").Find(&comments)
+		hideTombstones(comments)
+	}
+	canPost, commentNotice := mayComment(blogpost, userID)
+
+	// Set the Content-Type header
+	c.Type("html")
+
+	// Render the post template; the body is Markdown rendered with raw HTML escaped
+	return TemplatesInstance.post.Execute(c.Response().BodyWriter(), fiber.Map{
+		"Meta":      meta,
+		"Post":      blogpost,
+		"Body":      template.HTML(tools.RenderMarkdown(linkMentions(c, blogpost.Desc))),
+		"AuthorURL": profileURL(c, blogpost.UserID),
+		"Comments":  buildThreads(comments),
+		"Commenting": fiber.Map{
+			"Disabled": blogpost.CommentAccess == structures.CommentsDisabled,
+			"Allowed":  canPost && userID != "",
+			"Notice":   commentNotice,
+		},
+	})
+}
+
+func RenderProfilePage(c *fiber.Ctx) error {
+	var user structures.User
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&user).Error; err != nil || !canSeeProfile(user, userID) {
+		return c.Status(fiber.StatusNotFound).SendString("User not found")
+	}
+
+	var posts []structures.Blog
+	db.DB.Scopes(listedPosts(userID)).Where("blogs.user_id = ?", user.Id).
+		Order("blogs.pinned_at IS NULL, blogs.pinned_at desc, created_at desc").Limit(50).Find(&posts)
+
+	name := displayName(user.FirstName, user.LastName)
+	meta := pageMeta{
+		SiteName:    tools.EnvString("SITE_NAME", "Blog"),
+		Type:        "profile",
+		Title:       name,
+		Description: "Posts by " + name,
+		URL:         profileURL(c, strconv.Itoa(int(user.Id))),
+	}
+
+	// Set the Content-Type header
+	c.Type("html")
+
+	// Render the profile template
+	return TemplatesInstance.profile.Execute(c.Response().BodyWriter(), fiber.Map{
+		"Meta":    meta,
+		"Name":    name,
+		"Posts":   posts,
+		"FeedURL": siteURL(c) + "/feeds/users/" + strconv.Itoa(int(user.Id)) + "/rss",
+	})
+}
@@ -0,0 +1,434 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/related"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReportPost reports the post named in the URL. The body gives a reason
+// code and optional details.
+func ReportPost(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var post structures.Blog
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&post).Error; err != nil || !canReadPost(post, userID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Blog post not found",
+		})
+	}
+	if postRole(post, userID) != "" {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Cannot report your own post",
+		})
+	}
+
+	return fileReport(c, userID, structures.ReportTargetPost, post.Id)
+}
+
+// ReportComment reports the comment named in the URL.
+func ReportComment(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var comment structures.Comment
+	err = db.DB.Where("id = ? AND post_id = ?", c.Params("commentID"), c.Params("id")).First(&comment).Error
+	if err != nil || comment.Deleted || comment.Status != structures.CommentApproved || !canReadPostID(comment.PostID, c) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Comment not found",
+		})
+	}
+	if comment.UserID == userID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Cannot report your own comment",
+		})
+	}
+
+	return fileReport(c, userID, structures.ReportTargetComment, comment.ID)
+}
+
+// ReportUser reports the user named in the URL.
+func ReportUser(c *fiber.Ctx) error {
+	userID, err := tools.Parsejwt(c.Cookies("jwt"))
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	reportedID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+	if strconv.Itoa(reportedID) == userID {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Cannot report yourself",
+		})
+	}
+	var reported structures.User
+	if err := db.DB.First(&reported, reportedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	return fileReport(c, userID, structures.ReportTargetUser, reported.Id)
+}
+
+// ReportQueue lists reports for moderators, oldest first. ?status= picks
+// the status (open by default, "all" for every status), ?type= the target
+// type and ?reason= the reason code.
+func ReportQueue(c *fiber.Ctx) error {
+	if _, ok, err := requireModerator(c); !ok {
+		return err
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	limit := 20
+	offset := (page - 1) * limit
+
+	query := db.DB.Model(&structures.Report{})
+	if status := c.Query("status", structures.ReportOpen); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if t := c.Query("type"); t != "" {
+		query = query.Where("target_type = ?", t)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+
+	var total int64
+	var reports []structures.Report
+	query.Session(&gorm.Session{}).Count(&total)
+	if err := query.Preload("Reporter").Order("id").Offset(offset).Limit(limit).Find(&reports).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve reports",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": reports,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": lastPage(total, limit),
+		},
+	})
+}
+
+// GetReport returns a report for moderators, along with the reported
+// content and every report filed against it.
+func GetReport(c *fiber.Ctx) error {
+	if _, ok, err := requireModerator(c); !ok {
+		return err
+	}
+
+	var report structures.Report
+	if err := db.DB.Preload("Reporter").Where("id = ?", c.Params("reportID")).First(&report).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Report not found",
+		})
+	}
+
+	var reports []structures.Report
+	db.DB.Preload("Reporter").
+		Where("target_type = ? AND target_id = ?", report.TargetType, report.TargetID).
+		Order("id").Find(&reports)
+
+	return c.JSON(fiber.Map{
+		"report":  report,
+		"target":  reportTarget(report),
+		"reports": reports,
+	})
+}
+
+// ResolveReport moves a report, and every undecided report on the same
+// target, to the status given in the body with an optional note. Resolved
+// reports reject the content or keep the user hidden; dismissing the last
+// reports restores content that was hidden by them.
+func ResolveReport(c *fiber.Ctx) error {
+	moderator, ok, err := requireModerator(c)
+	if !ok {
+		return err
+	}
+
+	var report structures.Report
+	if err := db.DB.Where("id = ?", c.Params("reportID")).First(&report).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "Report not found",
+		})
+	}
+
+	var resolution struct {
+		Status string `json:"status" form:"status"`
+		Note   string `json:"note" form:"note"`
+	}
+	if err := c.BodyParser(&resolution); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid resolution payload",
+		})
+	}
+	if !structures.ValidReportStatus(resolution.Status) || resolution.Status == structures.ReportOpen {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Status must be reviewing, resolved or dismissed",
+		})
+	}
+
+	updates := map[string]interface{}{"status": resolution.Status}
+	if resolution.Status != structures.ReportReviewing {
+		updates["resolved_by"] = strconv.Itoa(int(moderator.Id))
+		updates["resolved_at"] = time.Now()
+		updates["resolution_note"] = strings.TrimSpace(resolution.Note)
+	}
+	result := db.DB.Model(&structures.Report{}).
+		Where("target_type = ? AND target_id = ?", report.TargetType, report.TargetID).
+		Where("status IN ? OR id = ?", []string{structures.ReportOpen, structures.ReportReviewing}, report.ID).
+		Updates(updates)
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to resolve report",
+		})
+	}
+
+	switch resolution.Status {
+	case structures.ReportResolved:
+		err = actionReported(report.TargetType, report.TargetID)
+	case structures.ReportDismissed:
+		err = restoreReported(report.TargetType, report.TargetID)
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to update reported content",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Report " + resolution.Status,
+		"updated": result.RowsAffected,
+	})
+}
+
+// fileReport saves a report by the user on a target and hides the target
+// once enough users reported it. Each user reports a target once.
+func fileReport(c *fiber.Ctx, userID, targetType string, targetID uint) error {
+	var reportData struct {
+		Reason  string `json:"reason" form:"reason"`
+		Details string `json:"details" form:"details"`
+	}
+	if err := c.BodyParser(&reportData); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid report payload",
+		})
+	}
+	if !structures.ValidReportReason(reportData.Reason) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Unknown report reason " + strconv.Quote(reportData.Reason),
+		})
+	}
+
+	report := structures.Report{
+		ReporterID: userID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Reason:     reportData.Reason,
+		Details:    tools.Truncate(strings.TrimSpace(reportData.Details), 2000),
+		Status:     structures.ReportOpen,
+	}
+	result := db.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&report)
+	if result.Error != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to save report",
+		})
+	}
+	if result.RowsAffected == 0 {
+		c.Status(fiber.StatusConflict)
+		return c.JSON(fiber.Map{
+			"message": "You already reported this",
+		})
+	}
+
+	if threshold := tools.EnvInt("REPORT_THRESHOLD", 3); threshold > 0 && pendingReports(targetType, targetID) >= int64(threshold) {
+		if err := hideReported(targetType, targetID); err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to hide reported content",
+			})
+		}
+	}
+
+	c.Status(fiber.StatusCreated)
+	return c.JSON(fiber.Map{
+		"message": "Report received",
+		"report":  report,
+	})
+}
+
+// pendingReports counts the reports on a target still waiting for a
+// moderator.
+func pendingReports(targetType string, targetID uint) int64 {
+	var count int64
+	db.DB.Model(&structures.Report{}).
+		Where("target_type = ? AND target_id = ? AND status IN ?", targetType, targetID,
+			[]string{structures.ReportOpen, structures.ReportReviewing}).
+		Count(&count)
+	return count
+}
+
+// hideReported holds reported posts and comments for moderation and hides
+// reported users' profiles. Content already held or rejected is left alone.
+func hideReported(targetType string, targetID uint) error {
+	switch targetType {
+	case structures.ReportTargetPost:
+		err := db.DB.Model(&structures.Blog{}).
+			Where("id = ? AND status = ?", targetID, structures.PostApproved).
+			UpdateColumns(map[string]interface{}{"status": structures.PostPending, "held_reason": structures.ReportHeldReason}).Error
+		related.Invalidate(targetID)
+		return err
+	case structures.ReportTargetComment:
+		var comment structures.Comment
+		if err := db.DB.Where("id = ?", targetID).First(&comment).Error; err != nil || comment.Status != structures.CommentApproved {
+			return nil
+		}
+		return db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&comment).UpdateColumns(map[string]interface{}{
+				"status":      structures.CommentPending,
+				"held_reason": structures.ReportHeldReason,
+			}).Error; err != nil {
+				return err
+			}
+			if comment.ParentID == nil {
+				return nil
+			}
+			return tx.Model(&structures.Comment{}).Where("id = ?", *comment.ParentID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error
+		})
+	case structures.ReportTargetUser:
+		return db.DB.Model(&structures.User{}).Where("id = ?", targetID).Update("hidden", true).Error
+	}
+	return nil
+}
+
+// restoreReported publishes again the content hidden by reports, once no
+// report on it is waiting anymore. Content held for other reasons stays
+// held.
+func restoreReported(targetType string, targetID uint) error {
+	if pendingReports(targetType, targetID) > 0 {
+		return nil
+	}
+	switch targetType {
+	case structures.ReportTargetPost:
+		err := db.DB.Model(&structures.Blog{}).
+			Where("id = ? AND status = ? AND held_reason = ?", targetID, structures.PostPending, structures.ReportHeldReason).
+			UpdateColumns(map[string]interface{}{"status": structures.PostApproved, "held_reason": ""}).Error
+		related.Invalidate(targetID)
+		return err
+	case structures.ReportTargetComment:
+		var comment structures.Comment
+		if err := db.DB.Where("id = ?", targetID).First(&comment).Error; err != nil ||
+			comment.Status != structures.CommentPending || comment.HeldReason != structures.ReportHeldReason {
+			return nil
+		}
+		if err := approveComment(comment); err != nil {
+			return err
+		}
+		return db.DB.Model(&comment).UpdateColumn("held_reason", "").Error
+	case structures.ReportTargetUser:
+		return db.DB.Model(&structures.User{}).Where("id = ?", targetID).Update("hidden", false).Error
+	}
+	return nil
+}
+
+// actionReported acts on reports a moderator upheld: the post or comment
+// is rejected, the user's profile hidden.
+func actionReported(targetType string, targetID uint) error {
+	switch targetType {
+	case structures.ReportTargetPost:
+		err := db.DB.Model(&structures.Blog{}).Where("id = ?", targetID).
+			UpdateColumn("status", structures.PostRejected).Error
+		related.Invalidate(targetID)
+		return err
+	case structures.ReportTargetComment:
+		var comment structures.Comment
+		if err := db.DB.Where("id = ?", targetID).First(&comment).Error; err != nil || comment.Status == structures.CommentRejected {
+			return nil
+		}
+		return rejectComment(comment)
+	case structures.ReportTargetUser:
+		return db.DB.Model(&structures.User{}).Where("id = ?", targetID).Update("hidden", true).Error
+	}
+	return nil
+}
+
+// reportTarget loads the reported post, comment or user, or nil when it
+// was deleted since.
+func reportTarget(report structures.Report) interface{} {
+	switch report.TargetType {
+	case structures.ReportTargetPost:
+		var post structures.Blog
+		if err := db.DB.Preload("User").Where("id = ?", report.TargetID).First(&post).Error; err == nil {
+			return post
+		}
+	case structures.ReportTargetComment:
+		var comment structures.Comment
+		if err := db.DB.Preload("User").Where("id = ?", report.TargetID).First(&comment).Error; err == nil {
+			return comment
+		}
+	case structures.ReportTargetUser:
+		var user structures.User
+		if err := db.DB.Where("id = ?", report.TargetID).First(&user).Error; err == nil {
+			return user
+		}
+	}
+	return nil
+}
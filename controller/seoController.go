@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+const sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapIndex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	NS       string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	NS      string   `xml:"xmlns,attr"`
+	URLs    []urlEntry
+}
+
+type urlEntry struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+// sitemapPageSize is the number of URLs per sitemap, capped at the 50,000
+// allowed by the protocol.
+func sitemapPageSize() int {
+	size := tools.EnvInt("SITEMAP_PAGE_SIZE", 5000)
+	if size < 1 || size > 50000 {
+		size = 5000
+	}
+	return size
+}
+
+// SitemapIndex lists the paginated post and author sitemaps.
+func SitemapIndex(c *fiber.Ctx) error {
+	size := sitemapPageSize()
+	base := siteURL(c)
+
+	var postState struct {
+		Total   int64
+		Updated *time.Time
+	}
+	db.DB.Model(&structures.Blog{}).
+		Scopes(publishedPosts).
+		Select("COUNT(*) as total, MAX(updated_at) as updated").
+		Scan(&postState)
+
+	var authors int64
+	db.DB.Model(&structures.Blog{}).
+		Scopes(publishedPosts, visibleAuthors).
+		Distinct("user_id").
+		Count(&authors)
+
+	index := sitemapIndex{NS: sitemapNS}
+	for page := 1; page <= pages(postState.Total, size); page++ {
+		entry := sitemapEntry{Loc: base + "/sitemaps/posts-" + strconv.Itoa(page) + ".xml"}
+		if postState.Updated != nil {
+			entry.LastMod = postState.Updated.UTC().Format(time.RFC3339)
+		}
+		index.Sitemaps = append(index.Sitemaps, entry)
+	}
+	for page := 1; page <= pages(authors, size); page++ {
+		index.Sitemaps = append(index.Sitemaps, sitemapEntry{
+			Loc: base + "/sitemaps/authors-" + strconv.Itoa(page) + ".xml",
+		})
+	}
+
+	return sendXML(c, index)
+}
+
+// PostSitemap lists one page of public posts.
+func PostSitemap(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Params("page"))
+	if err != nil || page < 1 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	size := sitemapPageSize()
+
+	var posts []structures.Blog
+	db.DB.Select("id, updated_at").
+		Scopes(publishedPosts).
+		Order("id").Offset((page - 1) * size).Limit(size).
+		Find(&posts)
+	if len(posts) == 0 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	set := urlSet{NS: sitemapNS}
+	for _, post := range posts {
+		entry := urlEntry{Loc: postURL(c, post.Id)}
+		if !post.UpdatedAt.IsZero() {
+			entry.LastMod = post.UpdatedAt.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+	return sendXML(c, set)
+}
+
+// AuthorSitemap lists one page of profiles of users with public posts.
+func AuthorSitemap(c *fiber.Ctx) error {
+	page, err := strconv.Atoi(c.Params("page"))
+	if err != nil || page < 1 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	size := sitemapPageSize()
+
+	var rows []struct {
+		UserID  string
+		Updated *time.Time
+	}
+	db.DB.Model(&structures.Blog{}).
+		Select("user_id, MAX(updated_at) as updated").
+		Scopes(publishedPosts, visibleAuthors).
+		Group("user_id").Order("user_id").
+		Offset((page - 1) * size).Limit(size).
+		Scan(&rows)
+	if len(rows) == 0 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	set := urlSet{NS: sitemapNS}
+	for _, row := range rows {
+		entry := urlEntry{Loc: profileURL(c, row.UserID)}
+		if row.Updated != nil {
+			entry.LastMod = row.Updated.UTC().Format(time.RFC3339)
+		}
+		set.URLs = append(set.URLs, entry)
+	}
+	return sendXML(c, set)
+}
+
+// RobotsTxt keeps crawlers on the public pages and points them at the
+// sitemap.
+func RobotsTxt(c *fiber.Ctx) error {
+	lines := []string{
+		"User-agent: *",
+		"Allow: /posts/",
+		"Allow: /users/",
+		"Allow: /feeds/",
+		"Allow: /api/uploads/",
+		"Disallow: /api/",
+		"Disallow: /createBlog",
+		"",
+		"Sitemap: " + siteURL(c) + "/sitemap.xml",
+		"",
+	}
+	c.Type("txt")
+	return c.SendString(strings.Join(lines, "\n"))
+}
+
+func pages(total int64, size int) int {
+	return int((total + int64(size) - 1) / int64(size))
+}
+
+func sendXML(c *fiber.Ctx, v interface{}) error {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return c.Send(append([]byte(xml.Header), out...))
+}
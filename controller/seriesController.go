@@ -0,0 +1,337 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+// CreateSeries creates a new series for the current user.
+func CreateSeries(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var seriesData structures.Series
+	if err := c.BodyParser(&seriesData); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid series payload",
+		})
+	}
+	if strings.TrimSpace(seriesData.Title) == "" {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Series title is required",
+		})
+	}
+
+	series := structures.Series{
+		UserID:      userID,
+		Title:       strings.TrimSpace(seriesData.Title),
+		Description: seriesData.Description,
+	}
+	if err := db.DB.Create(&series).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to create series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Series created",
+		"series":  series,
+	})
+}
+
+// MySeries returns every series of the current user.
+func MySeries(c *fiber.Ctx) error {
+	// Extract user ID from JWT cookie
+	cookie := c.Cookies("jwt")
+	userID, err := tools.Parsejwt(cookie)
+	if err != nil {
+		c.Status(fiber.StatusUnauthorized)
+		return c.JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var series []structures.Series
+	if err := db.DB.Where("user_id = ?", userID).Order("created_at").Find(&series).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"series": series,
+	})
+}
+
+// UserSeries returns the series of a user.
+func UserSeries(c *fiber.Ctx) error {
+	ownerID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+
+	var series []structures.Series
+	if err := db.DB.Where("user_id = ?", ownerID).Order("created_at").Find(&series).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"series": series,
+	})
+}
+
+// GetSeries is the landing page of a series: the series, its author and the
+// posts the current user may read, in order.
+func GetSeries(c *fiber.Ctx) error {
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+
+	series, status, message := findSeries(c.Params("seriesID"))
+	if status != 0 {
+		c.Status(status)
+		return c.JSON(fiber.Map{
+			"message": message,
+		})
+	}
+
+	var items []structures.SeriesPost
+	readable := db.DB.Model(&structures.Blog{}).Select("id").Scopes(readablePosts(userID))
+	if err := db.DB.Where("series_id = ? AND post_id IN (?)", series.ID, readable).Preload("Post.User").Order("position").Find(&items).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to retrieve series",
+		})
+	}
+
+	posts := make([]structures.Blog, len(items))
+	for i, item := range items {
+		posts[i] = item.Post
+	}
+	decoratePosts(posts, userID)
+	listFields(c, posts)
+	for i := range items {
+		items[i].Post = posts[i]
+	}
+	series.Posts = items
+
+	return c.JSON(fiber.Map{
+		"series": series,
+	})
+}
+
+// UpdateSeries changes the title or description of a series.
+func UpdateSeries(c *fiber.Ctx) error {
+	series, ok, err := ownedSeries(c)
+	if !ok {
+		return err
+	}
+
+	var seriesData struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+	}
+	if err := c.BodyParser(&seriesData); err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid series payload",
+		})
+	}
+	if seriesData.Title != nil {
+		if strings.TrimSpace(*seriesData.Title) == "" {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Series title is required",
+			})
+		}
+		series.Title = strings.TrimSpace(*seriesData.Title)
+	}
+	if seriesData.Description != nil {
+		series.Description = *seriesData.Description
+	}
+
+	if err := db.DB.Save(&series).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to update series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Series updated",
+		"series":  series,
+	})
+}
+
+// DeleteSeries deletes a series. Its posts are kept.
+func DeleteSeries(c *fiber.Ctx) error {
+	series, ok, err := ownedSeries(c)
+	if !ok {
+		return err
+	}
+
+	if err := db.DB.Where("series_id = ?", series.ID).Delete(&structures.SeriesPost{}).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to delete series",
+		})
+	}
+	if err := db.DB.Delete(&series).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to delete series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Series deleted",
+	})
+}
+
+// AddToSeries appends one of the author's posts to the end of a series. A
+// post can only be part of one series.
+func AddToSeries(c *fiber.Ctx) error {
+	series, ok, err := ownedSeries(c)
+	if !ok {
+		return err
+	}
+
+	// Check if the blog post exists and belongs to the series author
+	blogPost, ok, err := collectedPost(c)
+	if !ok {
+		return err
+	}
+	if blogPost.UserID != series.UserID {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Only your own posts can be added to a series",
+		})
+	}
+
+	var item structures.SeriesPost
+	if err := db.DB.Where("post_id = ?", blogPost.Id).First(&item).Error; err == nil {
+		if item.SeriesID == series.ID {
+			return c.JSON(fiber.Map{
+				"message": "Post already in series",
+				"item":    item,
+			})
+		}
+		c.Status(fiber.StatusConflict)
+		return c.JSON(fiber.Map{
+			"message": "Post is already part of another series",
+		})
+	}
+
+	item = structures.SeriesPost{
+		SeriesID: series.ID,
+		PostID:   blogPost.Id,
+		Position: seriesPosts(series).nextPosition(),
+	}
+	if err := db.DB.Create(&item).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to add post to series",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Post added to series",
+		"item":    item,
+	})
+}
+
+// RemoveFromSeries removes a post from a series.
+func RemoveFromSeries(c *fiber.Ctx) error {
+	series, ok, err := ownedSeries(c)
+	if !ok {
+		return err
+	}
+
+	return seriesPosts(series).remove(c)
+}
+
+// ReorderSeries sets the order of the posts in a series. The body lists post
+// IDs in the wanted order; posts that are left out keep their relative order
+// after the listed ones.
+func ReorderSeries(c *fiber.Ctx) error {
+	series, ok, err := ownedSeries(c)
+	if !ok {
+		return err
+	}
+
+	return seriesPosts(series).reorder(c)
+}
+
+// findSeries loads a series by its URL parameter. It returns a non-zero
+// status and a message when the series can't be loaded.
+func findSeries(param string) (structures.Series, int, string) {
+	var series structures.Series
+	status, message := findCollection(param, &series, "series")
+	return series, status, message
+}
+
+// ownedSeries loads the series named in the URL and checks that it belongs
+// to the current user. When ok is false the response has already been
+// written and err must be returned by the handler.
+func ownedSeries(c *fiber.Ctx) (series structures.Series, ok bool, err error) {
+	ok, err = ownedCollection(c, "seriesID", &series, "series", func() string { return series.UserID })
+	return series, ok, err
+}
+
+// attachSeries fills in the series navigation of a post. Parts the user
+// can't read are left out, so previous and next always lead somewhere.
+func attachSeries(post *structures.Blog, userID string) {
+	var membership structures.SeriesPost
+	if err := db.DB.Where("post_id = ?", post.Id).First(&membership).Error; err != nil {
+		return
+	}
+	var series structures.Series
+	if err := db.DB.Where("id = ?", membership.SeriesID).First(&series).Error; err != nil {
+		return
+	}
+
+	var parts []structures.SeriesLink
+	readable := db.DB.Model(&structures.Blog{}).Select("id").Scopes(readablePosts(userID))
+	db.DB.Table("series_posts").
+		Select("blogs.id, blogs.title").
+		Joins("JOIN blogs ON blogs.id = series_posts.post_id").
+		Where("series_posts.series_id = ? AND series_posts.post_id IN (?)", series.ID, readable).
+		Order("series_posts.position").
+		Scan(&parts)
+
+	nav := &structures.SeriesNav{ID: series.ID, Title: series.Title, Parts: len(parts)}
+	for i, part := range parts {
+		if part.ID != post.Id {
+			continue
+		}
+		nav.Part = i + 1
+		if i > 0 {
+			nav.Previous = &parts[i-1]
+		}
+		if i+1 < len(parts) {
+			nav.Next = &parts[i+1]
+		}
+	}
+	post.Series = nav
+}
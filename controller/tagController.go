@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+)
+
+// maxTagsPerPost caps the number of tags kept on a single post.
+const maxTagsPerPost = 10
+
+// resolveTags finds the tags with the given names, creating the missing
+// ones. Names that slugify to the same value are merged.
+func resolveTags(names []string) ([]structures.Tag, error) {
+	var tags []structures.Tag
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := structures.Slugify(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		tag := structures.Tag{Name: name, Slug: slug}
+		if err := db.DB.Where("slug = ?", slug).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+		if len(tags) == maxTagsPerPost {
+			break
+		}
+	}
+	return tags, nil
+}
+
+// setPostTags replaces the tags of a post with the given names.
+func setPostTags(post *structures.Blog, names []string) error {
+	tags, err := resolveTags(names)
+	if err != nil {
+		return err
+	}
+	if err := db.DB.Model(post).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	post.Tags = tags
+	return nil
+}
+
+// attachTags loads the tags of the given posts with a single query.
+func attachTags(posts []structures.Blog) {
+	if len(posts) == 0 {
+		return
+	}
+	ids := make([]uint, len(posts))
+	for i, post := range posts {
+		ids[i] = post.Id
+	}
+	var rows []struct {
+		BlogID uint
+		structures.Tag
+	}
+	db.DB.Table("tags").
+		Select("post_tags.blog_id, tags.*").
+		Joins("JOIN post_tags ON post_tags.tag_id = tags.id").
+		Where("post_tags.blog_id IN ?", ids).
+		Order("tags.name").
+		Scan(&rows)
+	byPost := map[uint][]structures.Tag{}
+	for _, row := range rows {
+		byPost[row.BlogID] = append(byPost[row.BlogID], row.Tag)
+	}
+	for i := range posts {
+		posts[i].Tags = byPost[posts[i].Id]
+		if posts[i].Tags == nil {
+			posts[i].Tags = []structures.Tag{}
+		}
+	}
+}
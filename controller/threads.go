@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// commentEditWindow is how long authors can edit their comments, read
+// from COMMENT_EDIT_MINUTES (default 15). Zero or less means forever.
+func commentEditWindow() time.Duration {
+	return time.Duration(tools.EnvInt("COMMENT_EDIT_MINUTES", 15)) * time.Minute
+}
+
+// replyParent returns the comment a new reply should hang under. Replies to
+// a comment already at the maximum depth go under its parent instead, so
+// threads never nest deeper than tools.MaxCommentDepth.
+func replyParent(parent structures.Comment) (structures.Comment, error) {
+	for parent.Depth >= tools.MaxCommentDepth() && parent.ParentID != nil {
+		var up structures.Comment
+		if err := db.DB.Where("id = ?", *parent.ParentID).First(&up).Error; err != nil {
+			return parent, err
+		}
+		parent = up
+	}
+	return parent, nil
+}
+
+// buildThreads nests comments under their parents. Comments must be sorted
+// oldest first; replies whose parent is missing are shown at the top level.
+func buildThreads(comments []structures.Comment) []structures.Comment {
+	byID := map[uint]bool{}
+	for _, comment := range comments {
+		byID[comment.ID] = true
+	}
+	children := map[uint][]structures.Comment{}
+	var roots []structures.Comment
+	for _, comment := range comments {
+		if comment.ParentID != nil && byID[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+
+	var nest func(comment structures.Comment, depth int, path string) structures.Comment
+	nest = func(comment structures.Comment, depth int, path string) structures.Comment {
+		comment.Depth = depth
+		comment.Path = path + strconv.Itoa(int(comment.ID))
+		for _, reply := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, nest(reply, depth+1, comment.Path+"/"))
+		}
+		return comment
+	}
+	threads := make([]structures.Comment, 0, len(roots))
+	for _, root := range roots {
+		threads = append(threads, nest(root, 0, ""))
+	}
+	return threads
+}
+
+// flattenThreads lists nested comments in reading order, each followed by
+// its replies, keeping their depth and path.
+func flattenThreads(threads []structures.Comment) []structures.Comment {
+	flat := []structures.Comment{}
+	var walk func(comments []structures.Comment)
+	walk = func(comments []structures.Comment) {
+		for _, comment := range comments {
+			replies := comment.Replies
+			comment.Replies = nil
+			flat = append(flat, comment)
+			walk(replies)
+		}
+	}
+	walk(threads)
+	return flat
+}
+
+// hideTombstones strips the content and author of deleted comments.
+func hideTombstones(comments []structures.Comment) {
+	for i := range comments {
+		if comments[i].Deleted {
+			comments[i].Content = ""
+			comments[i].UserID = ""
+			comments[i].User = structures.User{}
+		}
+	}
+}
+
+// removeComment deletes a comment. A comment with replies becomes a
+// tombstone so the replies keep their place; a tombstone left without
+// replies is deleted in turn.
+func removeComment(comment structures.Comment) error {
+	deleteReactions(structures.ReactionTargetComment, comment.ID)
+	db.DB.Where("comment_id = ?", comment.ID).Delete(&structures.CommentRevision{})
+	if hasReplies(comment) {
+		return db.DB.Model(&comment).Updates(map[string]interface{}{"deleted": true, "content": ""}).Error
+	}
+
+	if err := db.DB.Delete(&comment).Error; err != nil {
+		return err
+	}
+	if comment.ParentID == nil {
+		return nil
+	}
+	var parent structures.Comment
+	if err := db.DB.Where("id = ?", *comment.ParentID).First(&parent).Error; err != nil {
+		return nil
+	}
+	// Only approved replies are counted by their parent
+	if comment.Status == structures.CommentApproved {
+		if err := db.DB.Model(&parent).UpdateColumn("reply_count", gorm.Expr("reply_count - 1")).Error; err != nil {
+			return err
+		}
+	}
+	if parent.Deleted && !hasReplies(parent) {
+		return removeComment(parent)
+	}
+	return nil
+}
+
+// hasReplies tells whether any comment replies to the comment, whatever its
+// status. ReplyCount only counts the approved ones, but held replies need
+// their parent too to be placed once approved.
+func hasReplies(comment structures.Comment) bool {
+	var count int64
+	db.DB.Model(&structures.Comment{}).Where("parent_id = ?", comment.ID).Count(&count)
+	return count > 0
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// siteURL returns the public base URL of the site. SITE_URL wins over the
+// host the request came in on, so links stay stable behind proxies.
+func siteURL(c *fiber.Ctx) string {
+	if base := strings.TrimRight(os.Getenv("SITE_URL"), "/"); base != "" {
+		return base
+	}
+	return strings.TrimRight(c.BaseURL(), "/")
+}
+
+// postURL returns the public link of a post.
+func postURL(c *fiber.Ctx, id uint) string {
+	return siteURL(c) + "/posts/" + strconv.Itoa(int(id))
+}
+
+// profileURL returns the public link of a user's profile page.
+func profileURL(c *fiber.Ctx, userID string) string {
+	return siteURL(c) + "/users/" + userID
+}
+
+// absoluteURL turns a site-relative link into an absolute one.
+func absoluteURL(c *fiber.Ctx, link string) string {
+	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+		return link
+	}
+	return siteURL(c) + "/" + strings.TrimLeft(link, "/")
+}
+
+// displayName returns the name shown for an author.
+func displayName(firstName, lastName string) string {
+	return strings.TrimSpace(firstName + " " + lastName)
+}
@@ -3,12 +3,14 @@ package controller
 import (
 	"errors"
 	"fmt"
-	"github.com/gofiber/fiber/v2"
 	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/mention"
 	"github.com/aizeresalim/final/structures"
 	"github.com/aizeresalim/final/tools"
+	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 	"strconv"
+	"strings"
 )
 
 // DeleteUser deletes a user account.
@@ -37,9 +39,25 @@ func DeleteUser(c *fiber.Ctx) error {
 			"message": "Internal server error",
 		})
 	}
-	if err := db.DB.Where("user_id = ?", userID).Delete(&structures.Blog{}).Error; err != nil {
+	// Posts go one by one so that what hangs off them goes too
+	var posts []structures.Blog
+	db.DB.Where("user_id = ?", userID).Find(&posts)
+	for _, post := range posts {
+		if err := removePost(post); err != nil {
+			c.Status(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"message": "Failed to delete associated blogs",
+			})
+		}
+	}
+	db.DB.Where("user_id = ?", userID).Delete(&structures.PostAuthor{})
+	db.DB.Where("user_id = ? OR blocked_id = ?", userID, userID).Delete(&structures.Block{})
+	db.DB.Where("user_id = ? OR actor_id = ?", userID, userID).Delete(&structures.Notification{})
+	db.DB.Where("reporter_id = ?", userID).Delete(&structures.Report{})
+	if err := deleteFollows(userID); err != nil {
+		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
-			"message": "Failed to delete associated blogs",
+			"message": "Failed to delete follows",
 		})
 	}
 
@@ -92,14 +110,32 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// Handles can be changed, as long as nobody else uses the new one
+	if handle := strings.TrimPrefix(updatedUser.Handle, "@"); handle != "" && handle != user.Handle {
+		if !mention.ValidHandle(handle) {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Handles are 2 to 32 letters, digits or underscores",
+			})
+		}
+		if mention.Taken(handle, userID) {
+			c.Status(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"message": "Handle already taken",
+			})
+		}
+		user.Handle = handle
+	}
+
 	// Update user information
 	user.FirstName = updatedUser.FirstName
 	user.LastName = updatedUser.LastName
 	user.Email = updatedUser.Email
 	user.Phone = updatedUser.Phone
 
-	// Save updated user to db
-	if err := db.DB.Save(&user).Error; err != nil {
+	// Save only the profile fields, so counters and flags changed meanwhile
+	// are kept
+	if err := db.DB.Model(&user).Select("first_name", "last_name", "email", "phone", "handle").Updates(&user).Error; err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to update user",
@@ -142,6 +178,110 @@ func GetUserInfo(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// GetUserProfile returns the public profile of a user. Contact details are
+// left out since anyone can read it.
+func GetUserProfile(c *fiber.Ctx) error {
+	profileID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Invalid user ID",
+		})
+	}
+
+	var user structures.User
+	if err := db.DB.Where("id = ?", profileID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Status(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"message": "User not found",
+			})
+		}
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Internal server error",
+		})
+	}
+
+	viewerID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	if !canSeeProfile(user, viewerID) {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+
+	// Posts the user pinned to their profile, most recently pinned first
+	var pinned []structures.Blog
+	db.DB.Scopes(listedPosts(viewerID)).
+		Where("blogs.user_id = ? AND blogs.pinned_at IS NOT NULL", user.Id).
+		Preload("User").
+		Order("blogs.pinned_at desc").
+		Find(&pinned)
+	decoratePosts(pinned, viewerID)
+	listFields(c, pinned)
+
+	return c.JSON(fiber.Map{
+		"id":              user.Id,
+		"first_name":      user.FirstName,
+		"last_name":       user.LastName,
+		"handle":          user.Handle,
+		"follower_count":  user.FollowerCount,
+		"following_count": user.FollowingCount,
+		"post_count":      user.PostCount,
+		"following":       isFollowing(viewerID, user.Id),
+		"pinned":          pinned,
+	})
+}
+
+// SetUserRole changes the role of the user named in the URL. Only admins
+// can, and not for themselves, so the site always keeps an admin.
+func SetUserRole(c *fiber.Ctx) error {
+	admin, err := currentUser(c)
+	if err != nil || !admin.IsAdmin() {
+		c.Status(fiber.StatusForbidden)
+		return c.JSON(fiber.Map{
+			"message": "Only admins can change roles",
+		})
+	}
+
+	var roleData struct {
+		Role string `json:"role" form:"role"`
+	}
+	if err := c.BodyParser(&roleData); err != nil || !structures.ValidRole(roleData.Role) {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Role must be user, moderator or admin",
+		})
+	}
+
+	var user structures.User
+	if err := db.DB.Where("id = ?", c.Params("id")).First(&user).Error; err != nil {
+		c.Status(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"message": "User not found",
+		})
+	}
+	if user.Id == admin.Id {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Cannot change your own role",
+		})
+	}
+	if err := db.DB.Model(&user).Update("role", roleData.Role).Error; err != nil {
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Failed to change role",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Role updated",
+		"id":      user.Id,
+		"role":    roleData.Role,
+	})
+}
+
 // FollowUser allows a user to follow another user
 func FollowUser(c *fiber.Ctx) error {
 	cookie := c.Cookies("jwt")
@@ -207,12 +347,23 @@ func FollowUser(c *fiber.Ctx) error {
 		FollowerID:     uint(followerID),
 		FollowedUserID: uint(followedUserID),
 	}
-	if err := db.DB.Create(&follow).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&follow).Error; err != nil {
+			return err
+		}
+		return countFollow(tx, follow, 1)
+	})
+	if err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to follow user",
 		})
 	}
+	sendNotification(structures.Notification{
+		UserID:  strconv.FormatUint(followedUserID, 10),
+		ActorID: followerIDStr,
+		Type:    structures.NotificationFollow,
+	})
 
 	return c.JSON(fiber.Map{
 		"message": "Successfully followed user",
@@ -256,7 +407,14 @@ func UnfollowUser(c *fiber.Ctx) error {
 	}
 
 	// Delete the follow relationship
-	if err := db.DB.Delete(&followRelationship).Error; err != nil {
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&followRelationship)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return countFollow(tx, followRelationship, -1)
+	})
+	if err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to unfollow user",
@@ -299,12 +457,15 @@ func GetPostsFromFollowedUsers(c *fiber.Ctx) error {
 
 	// Retrieve posts from followed users
 	var blogs []structures.Blog
-	if err := db.DB.Where("user_id IN (?)", followedUserIDs).Find(&blogs).Error; err != nil {
+	visible := []string{structures.VisibilityPublic, structures.VisibilityFollowers}
+	if err := db.DB.Where("user_id IN (?) AND visibility IN ? AND status = ?", followedUserIDs, visible, structures.PostApproved).Find(&blogs).Error; err != nil {
 		c.Status(fiber.StatusInternalServerError)
 		return c.JSON(fiber.Map{
 			"message": "Failed to retrieve posts from followed users",
 		})
 	}
+	decoratePosts(blogs, userID)
+	listFields(c, blogs)
 
 	return c.JSON(fiber.Map{
 		"posts": blogs,
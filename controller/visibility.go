@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// followedAuthors is the subquery of user IDs the user follows.
+func followedAuthors(userID string) *gorm.DB {
+	return db.DB.Model(&structures.Follow{}).Select("followed_user_id").Where("follower_id = ?", userID)
+}
+
+// coauthoredPosts is the subquery of post IDs the user co-authors.
+func coauthoredPosts(userID string) *gorm.DB {
+	return db.DB.Model(&structures.PostAuthor{}).Select("post_id").Where("user_id = ? AND status = ?", userID, structures.AuthorAccepted)
+}
+
+// readablePosts limits a blogs query to the posts the user may open by ID:
+// public and unlisted posts, followers-only posts of authors they follow and
+// the posts they wrote or co-author. Posts held as spam are only readable by
+// their authors. An empty userID stands for an anonymous visitor.
+func readablePosts(userID string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if userID == "" {
+			return tx.Where("blogs.visibility IN ? AND blogs.status = ?", []string{structures.VisibilityPublic, structures.VisibilityUnlisted}, structures.PostApproved)
+		}
+		return tx.Where(
+			db.DB.Where("blogs.visibility IN ? AND blogs.status = ?", []string{structures.VisibilityPublic, structures.VisibilityUnlisted}, structures.PostApproved).
+				Or("blogs.visibility = ? AND blogs.status = ? AND blogs.user_id IN (?)", structures.VisibilityFollowers, structures.PostApproved, followedAuthors(userID)).
+				Or("blogs.user_id = ?", userID).
+				Or("blogs.id IN (?)", coauthoredPosts(userID)),
+		)
+	}
+}
+
+// listedPosts limits a blogs query to the posts the user should see in
+// listings. It is readablePosts without other authors' unlisted posts.
+func listedPosts(userID string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if userID == "" {
+			return tx.Where("blogs.visibility = ? AND blogs.status = ?", structures.VisibilityPublic, structures.PostApproved)
+		}
+		return tx.Where(
+			db.DB.Where("blogs.visibility = ? AND blogs.status = ?", structures.VisibilityPublic, structures.PostApproved).
+				Or("blogs.visibility = ? AND blogs.status = ? AND blogs.user_id IN (?)", structures.VisibilityFollowers, structures.PostApproved, followedAuthors(userID)).
+				Or("blogs.user_id = ?", userID).
+				Or("blogs.id IN (?)", coauthoredPosts(userID)),
+		)
+	}
+}
+
+// publishedPosts limits a blogs query to the public posts that aren't held,
+// the ones shown to everyone in feeds and sitemaps.
+func publishedPosts(tx *gorm.DB) *gorm.DB {
+	return tx.Where("blogs.visibility = ? AND blogs.status = ?", structures.VisibilityPublic, structures.PostApproved)
+}
+
+// visibleAuthors limits a blogs query to the posts of users whose profile
+// isn't hidden after reports.
+func visibleAuthors(tx *gorm.DB) *gorm.DB {
+	return tx.Where("blogs.user_id NOT IN (?)", db.DB.Model(&structures.User{}).Select("id").Where("hidden = ?", true))
+}
+
+// canReadPost reports whether the user may open the post.
+func canReadPost(post structures.Blog, userID string) bool {
+	if post.Status != structures.PostApproved && post.Status != "" {
+		return userID != "" && postRole(post, userID) != ""
+	}
+	switch post.Visibility {
+	case structures.VisibilityPublic, structures.VisibilityUnlisted, "":
+		return true
+	}
+	if userID != "" && postRole(post, userID) != "" {
+		return true
+	}
+	if post.Visibility == structures.VisibilityFollowers && userID != "" {
+		var count int64
+		db.DB.Model(&structures.Follow{}).Where("follower_id = ? AND followed_user_id = ?", userID, post.UserID).Count(&count)
+		return count > 0
+	}
+	return false
+}
+
+// canReadPostID loads the post and reports whether the user making the
+// request may open it. Missing posts are reported as unreadable.
+func canReadPostID(postID uint, c *fiber.Ctx) bool {
+	var post structures.Blog
+	if err := db.DB.Where("id = ?", postID).First(&post).Error; err != nil {
+		return false
+	}
+	userID, _ := tools.Parsejwt(c.Cookies("jwt"))
+	return canReadPost(post, userID)
+}
+
+// canComment tells whether the user may comment on the post under its
+// comment access setting and, when not, why. Authors of a followers-only
+// thread can always comment.
+func canComment(post structures.Blog, userID string) (bool, string) {
+	switch post.CommentAccess {
+	case structures.CommentsLocked:
+		return false, "Comments are locked on this post"
+	case structures.CommentsDisabled:
+		return false, "Comments are disabled on this post"
+	case structures.CommentsFollowers:
+		if userID == "" {
+			return false, "Only followers of the author can comment"
+		}
+		if postRole(post, userID) != "" {
+			return true, ""
+		}
+		var count int64
+		db.DB.Model(&structures.Follow{}).Where("follower_id = ? AND followed_user_id = ?", userID, post.UserID).Count(&count)
+		if count == 0 {
+			return false, "Only followers of the author can comment"
+		}
+	}
+	return true, ""
+}
+
+// canSeeProfile reports whether the viewer may open the user's profile.
+// Profiles hidden after reports are shown to their owner and moderators
+// only.
+func canSeeProfile(user structures.User, viewerID string) bool {
+	if !user.Hidden || viewerID == strconv.Itoa(int(user.Id)) {
+		return true
+	}
+	var viewer structures.User
+	return viewerID != "" && db.DB.Where("id = ?", viewerID).First(&viewer).Error == nil && viewer.IsModerator()
+}
@@ -29,7 +29,32 @@ func Connect() {
 		&structures.User{},
 		&structures.Blog{},
 		&structures.Comment{},
+		&structures.CommentRevision{},
 		&structures.Follow{},
+		&structures.Reaction{},
+		&structures.Bookmark{},
+		&structures.ReadingList{},
+		&structures.ReadingListItem{},
+		&structures.Series{},
+		&structures.SeriesPost{},
+		&structures.PostAuthor{},
+		&structures.CommentBan{},
+		&structures.Report{},
+		&structures.SpamToken{},
+		&structures.Block{},
+		&structures.Notification{},
+		&structures.NotificationPreference{},
+		&structures.PostDailyStat{},
+		&structures.PostReferrerStat{},
+		&structures.Media{},
+		&structures.PostMedia{},
+		&structures.Tag{},
+		&structures.ImportRecord{},
 	)
 
+	// Import records used to be unique per origin for every importer
+	if database.Migrator().HasIndex(&structures.ImportRecord{}, "idx_import_source") {
+		database.Migrator().DropIndex(&structures.ImportRecord{}, "idx_import_source")
+	}
+
 }
@@ -3,15 +3,25 @@ package main
 import (
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"github.com/aizeresalim/final/analytics"
 	"github.com/aizeresalim/final/db"
 	"github.com/aizeresalim/final/routes"
 )
 
 func main() {
 	db.Connect()
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	analytics.Start()
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env files")
@@ -19,6 +29,21 @@ func main() {
 	port := os.Getenv("PORT")
 	app := fiber.New()
 	routes.Setup(app)
-	app.Listen(":" + port)
+
+	// Stop on SIGINT/SIGTERM, letting requests in flight finish
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		app.Shutdown()
+	}()
+	if err := app.Listen(":" + port); err != nil {
+		log.Println(err)
+	}
+
+	// Write the post views still buffered
+	if err := analytics.Flush(); err != nil {
+		log.Println("flushing post views:", err)
+	}
 
 }
@@ -0,0 +1,160 @@
+// Package mention finds @handle mentions in Markdown text, resolves them to
+// users and links them to their profiles. Mentions inside code are left
+// alone.
+package mention
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+)
+
+var (
+	handlePattern  = regexp.MustCompile(`^[A-Za-z0-9_]{2,32}$`)
+	mentionPattern = regexp.MustCompile(`@([A-Za-z0-9_]{2,32})\b`)
+)
+
+// ValidHandle reports whether handle can be used as a user handle: 2 to 32
+// letters, digits or underscores.
+func ValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle)
+}
+
+// Replace calls fn with the handle of every mention outside code in text
+// and puts the result in place of the mention. Mentions glued to a word or
+// a path, as in e-mail addresses and URLs, are not mentions.
+func Replace(text string, fn func(handle string) string) string {
+	lines := strings.SplitAfter(text, "\n")
+	fenced := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+			continue
+		}
+		if fenced {
+			continue
+		}
+		// Odd parts sit between backticks, in inline code
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 {
+			parts[j] = replaceMentions(parts[j], fn)
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "")
+}
+
+func replaceMentions(text string, fn func(handle string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] > 0 {
+			if r, _ := utf8.DecodeLastRuneInString(text[:m[0]]); r == '/' || r == '@' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+				continue
+			}
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteString(fn(text[m[2]:m[3]]))
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Handles returns the distinct handles mentioned in text, lowercased, in
+// order of appearance.
+func Handles(text string) []string {
+	seen := map[string]bool{}
+	var handles []string
+	Replace(text, func(handle string) string {
+		if handle = strings.ToLower(handle); !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+		return "@" + handle
+	})
+	return handles
+}
+
+// Resolve returns the users mentioned in text, keyed by lowercased handle.
+// Handles nobody uses are left out.
+func Resolve(text string) map[string]structures.User {
+	return Users(Handles(text))
+}
+
+// Users returns the users with the given lowercased handles, keyed by
+// handle.
+func Users(handles []string) map[string]structures.User {
+	users := map[string]structures.User{}
+	if len(handles) == 0 {
+		return users
+	}
+	var found []structures.User
+	db.DB.Where("handle IN ?", handles).Find(&found)
+	for _, user := range found {
+		users[strings.ToLower(user.Handle)] = user
+	}
+	return users
+}
+
+// Link rewrites the mentions of existing users in text as Markdown links to
+// the URL returned by url.
+func Link(text string, url func(user structures.User) string) string {
+	users := Resolve(text)
+	if len(users) == 0 {
+		return text
+	}
+	return Replace(text, func(handle string) string {
+		if user, ok := users[strings.ToLower(handle)]; ok {
+			return "[@" + handle + "](" + url(user) + ")"
+		}
+		return "@" + handle
+	})
+}
+
+// Taken reports whether another user than userID already uses handle.
+func Taken(handle, userID string) bool {
+	var count int64
+	db.DB.Model(&structures.User{}).Where("handle = ? AND id <> ?", handle, userID).Count(&count)
+	return count > 0
+}
+
+// NewHandle picks a free handle for a user from their name, or from their
+// e-mail address when the name has nothing usable, adding a number when it
+// is taken.
+func NewHandle(user structures.User) string {
+	base := handleBase(user.FirstName + user.LastName)
+	if len(base) < 2 {
+		base = handleBase(strings.SplitN(user.Email, "@", 2)[0])
+	}
+	if len(base) < 2 {
+		base = "user"
+	}
+	if len(base) > 28 {
+		base = base[:28]
+	}
+	userID := strconv.Itoa(int(user.Id))
+	handle := base
+	for n := 2; Taken(handle, userID); n++ {
+		handle = base + strconv.Itoa(n)
+	}
+	return handle
+}
+
+// handleBase keeps the ASCII letters, digits and underscores of s,
+// lowercased.
+func handleBase(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -21,3 +21,13 @@ func IsAuthenticate(c *fiber.Ctx) error {
 
 	return c.Next()
 }
+
+// OptionalAuth lets anonymous visitors through. When a valid jwt cookie is
+// present the user ID is set in the context just like IsAuthenticate does.
+func OptionalAuth(c *fiber.Ctx) error {
+	if userID, err := tools.Parsejwt(c.Cookies("jwt")); err == nil {
+		c.Locals("userID", userID)
+	}
+
+	return c.Next()
+}
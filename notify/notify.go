@@ -0,0 +1,73 @@
+// Package notify delivers notifications to users. Producers describe what
+// happened with a structures.Notification and Send decides whether the user
+// gets it.
+package notify
+
+import (
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/realtime"
+	"github.com/aizeresalim/final/structures"
+)
+
+// Send delivers a notification to its user. Users aren't notified of their
+// own actions, of actions by users they blocked, of types they turned off,
+// or twice about the same thing.
+func Send(n structures.Notification) error {
+	if n.UserID == "" || n.UserID == n.ActorID || Blocked(n.UserID, n.ActorID) || !Enabled(n.UserID, n.Type) {
+		return nil
+	}
+
+	var count int64
+	db.DB.Model(&structures.Notification{}).Where(map[string]interface{}{
+		"user_id":    n.UserID,
+		"actor_id":   n.ActorID,
+		"type":       n.Type,
+		"post_id":    n.PostID,
+		"comment_id": n.CommentID,
+	}).Count(&count)
+	if count > 0 {
+		return nil
+	}
+	if err := db.DB.Create(&n).Error; err != nil {
+		return err
+	}
+	db.DB.Where("id = ?", n.ActorID).First(&n.Actor)
+	realtime.Publish(realtime.UserTopic(n.UserID), realtime.EventNotification, n)
+	return nil
+}
+
+// Blocked reports whether the user blocked the other one.
+func Blocked(userID, otherID string) bool {
+	var count int64
+	db.DB.Model(&structures.Block{}).Where("user_id = ? AND blocked_id = ?", userID, otherID).Count(&count)
+	return count > 0
+}
+
+// Enabled reports whether the user wants notifications of the given type.
+func Enabled(userID, notificationType string) bool {
+	var pref structures.NotificationPreference
+	if err := db.DB.Where("user_id = ? AND type = ?", userID, notificationType).First(&pref).Error; err != nil {
+		return true
+	}
+	return pref.Enabled
+}
+
+// Preferences returns whether each notification type is on for the user.
+func Preferences(userID string) map[string]bool {
+	prefs := map[string]bool{}
+	for _, t := range structures.NotificationTypes {
+		prefs[t] = true
+	}
+	var stored []structures.NotificationPreference
+	db.DB.Where("user_id = ?", userID).Find(&stored)
+	for _, pref := range stored {
+		prefs[pref.Type] = pref.Enabled
+	}
+	return prefs
+}
+
+// SetPreference turns a notification type on or off for the user.
+func SetPreference(userID, notificationType string, enabled bool) error {
+	pref := structures.NotificationPreference{UserID: userID, Type: notificationType}
+	return db.DB.Where(&pref).Assign(map[string]interface{}{"enabled": enabled}).FirstOrCreate(&pref).Error
+}
@@ -0,0 +1,198 @@
+// Package realtime pushes events to connected clients over Server-Sent
+// Events and WebSocket. Clients subscribe to topics on the hub; events are
+// published through a Broker, so that several instances of the server can
+// share them by plugging in a broker backed by a shared message bus.
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+)
+
+// Event types.
+const (
+	EventComment      = "comment"      // new comment on a post
+	EventPost         = "post"         // new post from a followed user
+	EventNotification = "notification" // new notification
+)
+
+// subscriptionBuffer is the number of events queued for a slow client
+// before new ones are dropped.
+const subscriptionBuffer = 32
+
+// Event is a message pushed to the subscribers of a topic.
+type Event struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// PostTopic is the topic of the comments on a post.
+func PostTopic(postID uint) string {
+	return "post:" + strconv.Itoa(int(postID))
+}
+
+// UserTopic is the private topic of a user: posts from the users they
+// follow and their notifications.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
+
+// Broker carries events between the instances of the server. Publish sends
+// an event to every instance, this one included; each instance hands the
+// events it receives to the function given to Listen.
+type Broker interface {
+	Publish(event Event) error
+	Listen(deliver func(event Event))
+}
+
+// localBroker is the default Broker, for a single instance: events are
+// delivered in-process.
+type localBroker struct {
+	mu      sync.RWMutex
+	deliver func(event Event)
+}
+
+// NewLocalBroker returns a broker delivering events within this process.
+func NewLocalBroker() Broker {
+	return &localBroker{}
+}
+
+func (b *localBroker) Publish(event Event) error {
+	b.mu.RLock()
+	deliver := b.deliver
+	b.mu.RUnlock()
+	if deliver != nil {
+		deliver(event)
+	}
+	return nil
+}
+
+func (b *localBroker) Listen(deliver func(event Event)) {
+	b.mu.Lock()
+	b.deliver = deliver
+	b.mu.Unlock()
+}
+
+// Subscription receives the events of the topics it is subscribed to on
+// Events until it is closed.
+type Subscription struct {
+	events chan Event
+	topics map[string]bool
+	closed bool
+}
+
+// Events is the channel the subscribed events arrive on.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+type hub struct {
+	mu     sync.RWMutex
+	subs   map[string]map[*Subscription]bool
+	broker Broker
+}
+
+var defaultHub = newHub(NewLocalBroker())
+
+func newHub(broker Broker) *hub {
+	h := &hub{subs: map[string]map[*Subscription]bool{}}
+	h.setBroker(broker)
+	return h
+}
+
+func (h *hub) setBroker(broker Broker) {
+	h.mu.Lock()
+	h.broker = broker
+	h.mu.Unlock()
+	broker.Listen(h.deliver)
+}
+
+// deliver hands an event to the local subscribers of its topic. Clients
+// that fall behind miss events rather than holding up the others.
+func (h *hub) deliver(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for sub := range h.subs[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// SetBroker replaces the broker events are published through, to share
+// them between instances.
+func SetBroker(broker Broker) {
+	defaultHub.setBroker(broker)
+}
+
+// Publish sends an event of the given type to the subscribers of a topic on
+// every instance. Failures are logged: real-time delivery is best effort.
+func Publish(topic, eventType string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Error encoding event:", err)
+		return
+	}
+	defaultHub.mu.RLock()
+	broker := defaultHub.broker
+	defaultHub.mu.RUnlock()
+	if err := broker.Publish(Event{Topic: topic, Type: eventType, Data: raw}); err != nil {
+		log.Println("Error publishing event:", err)
+	}
+}
+
+// Subscribe returns a subscription to the given topics.
+func Subscribe(topics ...string) *Subscription {
+	sub := &Subscription{events: make(chan Event, subscriptionBuffer), topics: map[string]bool{}}
+	for _, topic := range topics {
+		sub.Add(topic)
+	}
+	return sub
+}
+
+// Add subscribes to one more topic.
+func (s *Subscription) Add(topic string) {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	if s.closed || s.topics[topic] {
+		return
+	}
+	s.topics[topic] = true
+	if defaultHub.subs[topic] == nil {
+		defaultHub.subs[topic] = map[*Subscription]bool{}
+	}
+	defaultHub.subs[topic][s] = true
+}
+
+// Remove unsubscribes from a topic.
+func (s *Subscription) Remove(topic string) {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	s.remove(topic)
+}
+
+func (s *Subscription) remove(topic string) {
+	delete(s.topics, topic)
+	delete(defaultHub.subs[topic], s)
+	if len(defaultHub.subs[topic]) == 0 {
+		delete(defaultHub.subs, topic)
+	}
+}
+
+// Close unsubscribes from every topic and closes the events channel.
+func (s *Subscription) Close() {
+	defaultHub.mu.Lock()
+	defer defaultHub.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for topic := range s.topics {
+		s.remove(topic)
+	}
+	s.closed = true
+	close(s.events)
+}
@@ -0,0 +1,50 @@
+package realtime
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// heartbeat is how often idle connections get a keep-alive, so proxies
+// don't close them.
+const heartbeat = 25 * time.Second
+
+// ServeSSE streams the events of a subscription to the client as
+// Server-Sent Events, one "event:" per event type with the JSON data. The
+// subscription is closed when the client goes away.
+func ServeSSE(c *fiber.Ctx, sub *Subscription) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		// Tell the client the stream is open before the first event
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+		for {
+			select {
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, event.Data)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
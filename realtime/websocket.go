@@ -0,0 +1,305 @@
+package realtime
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// websocketGUID is appended to the client key to compute the handshake
+// answer (RFC 6455, section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close codes sent when the client breaks the protocol (RFC 6455, section
+// 7.4.1).
+const (
+	closeNormal          = 1000
+	closeProtocolError   = 1002
+	closeUnsupportedData = 1003
+	closeInvalidPayload  = 1007
+	closeTooBig          = 1009
+)
+
+// maxControlPayload is the largest payload of a control frame.
+const maxControlPayload = 125
+
+// maxMessageSize caps the messages clients can send; they only send small
+// commands.
+const maxMessageSize = 64 << 10
+
+// readTimeout closes connections that sent nothing, not even a pong to our
+// heartbeat pings, for that long.
+const readTimeout = 2*heartbeat + 10*time.Second
+
+// closeError is a protocol violation by the client; the connection is
+// closed with its code.
+type closeError struct {
+	code   uint16
+	reason string
+}
+
+func (e *closeError) Error() string {
+	return "websocket: " + e.reason
+}
+
+var errMessageTooLarge = &closeError{closeTooBig, "message too large"}
+
+// Conn is a server-side WebSocket connection.
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// IsWebSocket reports whether the request asks for a WebSocket upgrade.
+func IsWebSocket(c *fiber.Ctx) bool {
+	return strings.EqualFold(c.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(c.Get("Connection")), "upgrade") &&
+		c.Get("Sec-WebSocket-Key") != ""
+}
+
+// Upgrade switches the connection to the WebSocket protocol and runs
+// handler on it once the handshake is sent. The connection is closed when
+// handler returns; handler must not use the fiber context. Cross-origin
+// requests are refused, since the jwt cookie would authenticate them.
+func Upgrade(c *fiber.Ctx, handler func(conn *Conn)) error {
+	if !IsWebSocket(c) || c.Get("Sec-WebSocket-Version") != "13" {
+		c.Status(fiber.StatusUpgradeRequired)
+		return c.JSON(fiber.Map{
+			"message": "WebSocket upgrade required",
+		})
+	}
+	if origin := c.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, c.Hostname()) {
+			c.Status(fiber.StatusForbidden)
+			return c.JSON(fiber.Map{
+				"message": "Cross-origin WebSocket connections are not allowed",
+			})
+		}
+	}
+
+	sum := sha1.Sum([]byte(c.Get("Sec-WebSocket-Key") + websocketGUID))
+	c.Set("Upgrade", "websocket")
+	c.Set("Connection", "Upgrade")
+	c.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(sum[:]))
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.Context().Hijack(func(netConn net.Conn) {
+		defer netConn.Close()
+		handler(&Conn{conn: netConn, reader: bufio.NewReader(netConn)})
+	})
+	return nil
+}
+
+// ServeWebSocket pushes the events of a subscription to the client as JSON
+// text messages and hands the messages the client sends to onMessage. It
+// returns, closing the subscription, once either side goes away.
+func ServeWebSocket(conn *Conn, sub *Subscription, onMessage func(conn *Conn, message []byte)) {
+	defer sub.Close()
+	go func() {
+		defer sub.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			onMessage(conn, message)
+		}
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.Close()
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.writeFrame(opPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ReadMessage returns the next text message sent by the client,
+// reassembling fragmented ones and answering pings on the way. It returns
+// io.EOF once the client closed the connection. Clients breaking the
+// protocol, or sending binary messages, are sent a close frame with the
+// matching code and an error is returned.
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, c.fail(err)
+		}
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(opClose, payload)
+			return nil, io.EOF
+		case opText:
+			if fragmented {
+				return nil, c.fail(&closeError{closeProtocolError, "new message inside a fragmented one"})
+			}
+		case opContinuation:
+			if !fragmented {
+				return nil, c.fail(&closeError{closeProtocolError, "continuation frame without a message"})
+			}
+		case opBinary:
+			return nil, c.fail(&closeError{closeUnsupportedData, "binary messages are not supported"})
+		default:
+			return nil, c.fail(&closeError{closeProtocolError, "unknown opcode"})
+		}
+		message = append(message, payload...)
+		if len(message) > maxMessageSize {
+			return nil, c.fail(errMessageTooLarge)
+		}
+		if fin {
+			if !utf8.Valid(message) {
+				return nil, c.fail(&closeError{closeInvalidPayload, "text message is not valid UTF-8"})
+			}
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// fail sends the close frame matching a protocol violation, and returns
+// err.
+func (c *Conn) fail(err error) error {
+	var ce *closeError
+	if errors.As(err, &ce) {
+		c.writeFrame(opClose, []byte{byte(ce.code >> 8), byte(ce.code)})
+	}
+	return err
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(opText, data)
+}
+
+// Close tells the client the connection is closing normally.
+func (c *Conn) Close() error {
+	return c.writeFrame(opClose, []byte{byte(closeNormal >> 8), byte(closeNormal & 0xFF)})
+}
+
+// readFrame reads one frame. Client frames are always masked, use no
+// extension, and control frames are short and never fragmented.
+func (c *Conn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	var header [2]byte
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return
+	}
+	fin = header[0]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		err = &closeError{closeProtocolError, "reserved bits set without an extension"}
+		return
+	}
+	opcode = header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if !masked {
+		err = &closeError{closeProtocolError, "unmasked client frame"}
+		return
+	}
+	if opcode&0x8 != 0 && (!fin || length > maxControlPayload) {
+		err = &closeError{closeProtocolError, "fragmented or oversized control frame"}
+		return
+	}
+	if length > maxMessageSize {
+		err = errMessageTooLarge
+		return
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// writeFrame sends one unfragmented, unmasked frame.
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 127), ext[:]...)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(append(frame, payload...))
+	return err
+}
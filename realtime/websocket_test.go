@@ -0,0 +1,196 @@
+package realtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// clientFrame builds a masked frame as a client sends it. rsv is or-ed
+// into the first byte.
+func clientFrame(fin bool, opcode byte, payload []byte, rsv byte) []byte {
+	first := opcode | rsv
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		frame = append(append(frame, 0x80|127), ext[:]...)
+	}
+	mask := [4]byte{0x12, 0x34, 0x56, 0x78}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+type serverFrame struct {
+	opcode  byte
+	payload []byte
+}
+
+// readServerFrames parses the unmasked frames written by the server.
+func readServerFrames(t *testing.T, data []byte) []serverFrame {
+	t.Helper()
+	var frames []serverFrame
+	for len(data) > 0 {
+		if len(data) < 2 || data[0]&0x80 == 0 || data[1]&0x80 != 0 {
+			t.Fatalf("malformed server frame % x", data)
+		}
+		opcode := data[0] & 0x0F
+		length, rest := uint64(data[1]&0x7F), data[2:]
+		switch length {
+		case 126:
+			length, rest = uint64(binary.BigEndian.Uint16(rest)), rest[2:]
+		case 127:
+			length, rest = binary.BigEndian.Uint64(rest), rest[8:]
+		}
+		frames = append(frames, serverFrame{opcode, rest[:length]})
+		data = rest[length:]
+	}
+	return frames
+}
+
+// exchange feeds the client frames to a server connection, reads one
+// message, and returns it along with the frames the server answered.
+func exchange(t *testing.T, frames ...[]byte) ([]byte, []serverFrame, error) {
+	t.Helper()
+	server, client := net.Pipe()
+	conn := &Conn{conn: server, reader: bufio.NewReader(server)}
+
+	received := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		received <- data
+	}()
+	go func() {
+		for _, frame := range frames {
+			if _, err := client.Write(frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	message, err := conn.ReadMessage()
+	server.Close()
+	return message, readServerFrames(t, <-received), err
+}
+
+func closeCode(t *testing.T, frames []serverFrame) uint16 {
+	t.Helper()
+	if len(frames) == 0 || frames[len(frames)-1].opcode != opClose || len(frames[len(frames)-1].payload) < 2 {
+		t.Fatalf("expected a close frame with a code, got %v", frames)
+	}
+	return binary.BigEndian.Uint16(frames[len(frames)-1].payload)
+}
+
+func TestReadMessageText(t *testing.T) {
+	message, _, err := exchange(t, clientFrame(true, opText, []byte("hello"), 0))
+	if err != nil || string(message) != "hello" {
+		t.Fatalf("got %q, %v", message, err)
+	}
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	message, answered, err := exchange(t,
+		clientFrame(false, opText, []byte("hel"), 0),
+		clientFrame(true, opPing, []byte("p"), 0),
+		clientFrame(false, opContinuation, []byte("l"), 0),
+		clientFrame(true, opContinuation, []byte("o"), 0),
+	)
+	if err != nil || string(message) != "hello" {
+		t.Fatalf("got %q, %v", message, err)
+	}
+	if len(answered) != 1 || answered[0].opcode != opPong || string(answered[0].payload) != "p" {
+		t.Fatalf("expected a pong, got %v", answered)
+	}
+}
+
+func TestReadMessageLongPayload(t *testing.T) {
+	payload := strings.Repeat("a", 300)
+	message, _, err := exchange(t, clientFrame(true, opText, []byte(payload), 0))
+	if err != nil || string(message) != payload {
+		t.Fatalf("got %d bytes, %v", len(message), err)
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	_, answered, err := exchange(t, clientFrame(true, opClose, []byte{0x03, 0xE8, 'b', 'y', 'e'}, 0))
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if code := closeCode(t, answered); code != closeNormal {
+		t.Fatalf("expected close code %d, got %d", closeNormal, code)
+	}
+}
+
+func TestReadMessageProtocolErrors(t *testing.T) {
+	unmasked := clientFrame(true, opText, []byte("hi"), 0)
+	unmasked[1] &^= 0x80
+	unmasked = append(unmasked[:2], []byte("hi")...)
+
+	tests := []struct {
+		name   string
+		frames [][]byte
+		code   uint16
+	}{
+		{"reserved bits", [][]byte{clientFrame(true, opText, []byte("hi"), 0x40)}, closeProtocolError},
+		{"unknown opcode", [][]byte{clientFrame(true, 0x3, []byte("hi"), 0)}, closeProtocolError},
+		{"binary message", [][]byte{clientFrame(true, opBinary, []byte{1, 2}, 0)}, closeUnsupportedData},
+		{"continuation first", [][]byte{clientFrame(true, opContinuation, []byte("hi"), 0)}, closeProtocolError},
+		{"text inside fragmented message", [][]byte{
+			clientFrame(false, opText, []byte("he"), 0),
+			clientFrame(true, opText, []byte("llo"), 0),
+		}, closeProtocolError},
+		{"fragmented ping", [][]byte{clientFrame(false, opPing, []byte("p"), 0)}, closeProtocolError},
+		{"oversized ping", [][]byte{clientFrame(true, opPing, bytes.Repeat([]byte("p"), 126), 0)}, closeProtocolError},
+		{"unmasked frame", [][]byte{unmasked}, closeProtocolError},
+		{"invalid UTF-8", [][]byte{clientFrame(true, opText, []byte{0xff, 0xfe}, 0)}, closeInvalidPayload},
+		{"too large", [][]byte{clientFrame(true, opText, bytes.Repeat([]byte("a"), maxMessageSize+1), 0)}, closeTooBig},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, answered, err := exchange(t, test.frames...)
+			if err == nil || err == io.EOF {
+				t.Fatalf("expected a protocol error, got %v", err)
+			}
+			if code := closeCode(t, answered); code != test.code {
+				t.Fatalf("expected close code %d, got %d", test.code, code)
+			}
+		})
+	}
+}
+
+func TestWriteFrameLengths(t *testing.T) {
+	for _, n := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		server, client := net.Pipe()
+		conn := &Conn{conn: server, reader: bufio.NewReader(server)}
+		received := make(chan []byte)
+		go func() {
+			data, _ := io.ReadAll(client)
+			received <- data
+		}()
+
+		payload := bytes.Repeat([]byte("x"), n)
+		if err := conn.writeFrame(opText, payload); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+		frames := readServerFrames(t, <-received)
+		if len(frames) != 1 || frames[0].opcode != opText || !bytes.Equal(frames[0].payload, payload) {
+			t.Fatalf("length %d: frame not read back", n)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Package related ranks the posts related to a post by tag overlap, text
+// similarity and co-engagement. Rankings are cached in memory, up to a
+// limit, and dropped whenever one of the posts involved changes.
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+// Weights of the three signals in the final score.
+const (
+	tagWeight        = 0.5
+	textWeight       = 0.3
+	engagementWeight = 0.2
+)
+
+// maxRanked is the number of related posts kept per post.
+const maxRanked = 20
+
+// Scored is a related post with its score between 0 and 1.
+type Scored struct {
+	PostID uint    `json:"post_id"`
+	Score  float64 `json:"score"`
+}
+
+type entry struct {
+	posts    []Scored
+	computed time.Time
+}
+
+type cache struct {
+	mu      sync.Mutex
+	entries map[uint]entry
+	// generation counts the invalidations, so that a ranking computed
+	// while one happened is not cached.
+	generation uint64
+}
+
+var rankings = &cache{entries: map[uint]entry{}}
+
+// ttl is how long a ranking is served before being recomputed, so that new
+// engagement is eventually picked up. Read from RELATED_CACHE_MINUTES
+// (default 60).
+func ttl() time.Duration {
+	return time.Duration(tools.EnvInt("RELATED_CACHE_MINUTES", 60)) * time.Minute
+}
+
+// cacheSize is the number of rankings kept in memory, read from
+// RELATED_CACHE_SIZE (default 1000). The oldest are dropped first.
+func cacheSize() int {
+	if size := tools.EnvInt("RELATED_CACHE_SIZE", 1000); size > 0 {
+		return size
+	}
+	return 1000
+}
+
+// For returns the posts related to a post, best first. Only public posts are
+// ranked, so the result is the same for every reader. Rankings are computed
+// on the first read after they were dropped.
+func For(postID uint) ([]Scored, error) {
+	rankings.mu.Lock()
+	e, ok := rankings.entries[postID]
+	rankings.mu.Unlock()
+	if ok && time.Since(e.computed) < ttl() {
+		return e.posts, nil
+	}
+	return Refresh(postID)
+}
+
+// Refresh recomputes and caches the ranking of a post. The ranking is not
+// cached when a post changed while it was computed, as it may be stale.
+func Refresh(postID uint) ([]Scored, error) {
+	rankings.mu.Lock()
+	generation := rankings.generation
+	rankings.mu.Unlock()
+
+	posts, err := rank(postID)
+	if err != nil {
+		return nil, err
+	}
+
+	rankings.mu.Lock()
+	defer rankings.mu.Unlock()
+	if rankings.generation != generation {
+		return posts, nil
+	}
+	if _, ok := rankings.entries[postID]; !ok && len(rankings.entries) >= cacheSize() {
+		rankings.evictOldest()
+	}
+	rankings.entries[postID] = entry{posts: posts, computed: time.Now()}
+	return posts, nil
+}
+
+// Invalidate drops the cached rankings affected by a change to a post: its
+// own, the ones it appears in and the ones of posts sharing a tag with it.
+// They are recomputed when next read.
+func Invalidate(postID uint) {
+	var sharing []uint
+	db.DB.Table("post_tags").
+		Distinct("blog_id").
+		Where("tag_id IN (?)", db.DB.Table("post_tags").Select("tag_id").Where("blog_id = ?", postID)).
+		Pluck("blog_id", &sharing)
+
+	rankings.mu.Lock()
+	defer rankings.mu.Unlock()
+	rankings.drop(postID)
+	for _, id := range sharing {
+		delete(rankings.entries, id)
+	}
+}
+
+// Forget drops everything cached about a deleted post.
+func Forget(postID uint) {
+	rankings.mu.Lock()
+	defer rankings.mu.Unlock()
+	rankings.drop(postID)
+}
+
+// drop removes the ranking of a post and the rankings it appears in. The
+// caller holds mu.
+func (c *cache) drop(postID uint) {
+	c.generation++
+	delete(c.entries, postID)
+	for id, e := range c.entries {
+		for _, s := range e.posts {
+			if s.PostID == postID {
+				delete(c.entries, id)
+				break
+			}
+		}
+	}
+}
+
+// evictOldest removes the ranking computed longest ago. The caller holds mu.
+func (c *cache) evictOldest() {
+	var oldest uint
+	var at time.Time
+	for id, e := range c.entries {
+		if at.IsZero() || e.computed.Before(at) {
+			oldest, at = id, e.computed
+		}
+	}
+	delete(c.entries, oldest)
+}
+
+// rank scores the candidate posts against the given post.
+func rank(postID uint) ([]Scored, error) {
+	var post structures.Blog
+	if err := db.DB.Preload("Tags").Where("id = ?", postID).First(&post).Error; err != nil {
+		return nil, err
+	}
+
+	// Candidates are posts sharing a tag, posts engaged with by the same
+	// readers and the most recent posts, which only compete on text.
+	ids := map[uint]bool{}
+	tagIDs := make([]uint, len(post.Tags))
+	for i, tag := range post.Tags {
+		tagIDs[i] = tag.ID
+	}
+	if len(tagIDs) > 0 {
+		var sharing []uint
+		db.DB.Table("post_tags").Distinct("blog_id").Where("tag_id IN ?", tagIDs).Pluck("blog_id", &sharing)
+		for _, id := range sharing {
+			ids[id] = true
+		}
+	}
+	readers := engagedUsers([]uint{postID})[postID]
+	for id := range coEngaged(readers) {
+		ids[id] = true
+	}
+	var recent []uint
+	db.DB.Model(&structures.Blog{}).
+		Where("visibility = ? AND status = ?", structures.VisibilityPublic, structures.PostApproved).
+		Order("created_at desc").
+		Limit(tools.EnvInt("RELATED_POOL_SIZE", 200)).
+		Pluck("id", &recent)
+	for _, id := range recent {
+		ids[id] = true
+	}
+	delete(ids, postID)
+	if len(ids) == 0 {
+		return []Scored{}, nil
+	}
+
+	candidateIDs := make([]uint, 0, len(ids))
+	for id := range ids {
+		candidateIDs = append(candidateIDs, id)
+	}
+	var candidates []structures.Blog
+	if err := db.DB.Preload("Tags").
+		Where("id IN ? AND visibility = ? AND status = ?", candidateIDs, structures.VisibilityPublic, structures.PostApproved).
+		Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	engaged := engagedUsers(candidateIDs)
+
+	terms := termFrequencies(post)
+	created := map[uint]time.Time{}
+	scored := make([]Scored, 0, len(candidates))
+	for _, candidate := range candidates {
+		score := tagWeight*tagOverlap(post.Tags, candidate.Tags) +
+			textWeight*cosine(terms, termFrequencies(candidate)) +
+			engagementWeight*overlap(readers, engaged[candidate.Id])
+		if score <= 0 {
+			continue
+		}
+		scored = append(scored, Scored{PostID: candidate.Id, Score: math.Round(score*1000) / 1000})
+		created[candidate.Id] = candidate.CreatedAt
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return created[scored[i].PostID].After(created[scored[j].PostID])
+	})
+	if len(scored) > maxRanked {
+		scored = scored[:maxRanked]
+	}
+	return scored, nil
+}
+
+// engagedUsers returns, for each post, the users who reacted to, bookmarked
+// or commented on it.
+func engagedUsers(postIDs []uint) map[uint]map[string]bool {
+	var rows []struct {
+		PostID uint
+		UserID string
+	}
+	result := map[uint]map[string]bool{}
+	add := func() {
+		for _, row := range rows {
+			if result[row.PostID] == nil {
+				result[row.PostID] = map[string]bool{}
+			}
+			result[row.PostID][row.UserID] = true
+		}
+		rows = nil
+	}
+	db.DB.Model(&structures.Reaction{}).
+		Select("DISTINCT target_id AS post_id, user_id").
+		Where("target_type = ? AND target_id IN ?", structures.ReactionTargetPost, postIDs).
+		Scan(&rows)
+	add()
+	db.DB.Model(&structures.Bookmark{}).Select("DISTINCT post_id, user_id").Where("post_id IN ?", postIDs).Scan(&rows)
+	add()
+	db.DB.Model(&structures.Comment{}).Select("DISTINCT post_id, user_id").Where("post_id IN ?", postIDs).Scan(&rows)
+	add()
+	return result
+}
+
+// coEngaged returns the posts the given users engaged with.
+func coEngaged(users map[string]bool) map[uint]bool {
+	posts := map[uint]bool{}
+	if len(users) == 0 {
+		return posts
+	}
+	ids := make([]string, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	var found []uint
+	db.DB.Model(&structures.Reaction{}).Distinct("target_id").
+		Where("target_type = ? AND user_id IN ?", structures.ReactionTargetPost, ids).
+		Pluck("target_id", &found)
+	for _, id := range found {
+		posts[id] = true
+	}
+	found = nil
+	db.DB.Model(&structures.Bookmark{}).Distinct("post_id").Where("user_id IN ?", ids).Pluck("post_id", &found)
+	for _, id := range found {
+		posts[id] = true
+	}
+	found = nil
+	db.DB.Model(&structures.Comment{}).Distinct("post_id").Where("user_id IN ?", ids).Pluck("post_id", &found)
+	for _, id := range found {
+		posts[id] = true
+	}
+	return posts
+}
+
+// tagOverlap is the Jaccard index of two tag sets.
+func tagOverlap(a, b []structures.Tag) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := map[uint]bool{}
+	for _, tag := range a {
+		set[tag.ID] = true
+	}
+	shared := 0
+	for _, tag := range b {
+		if set[tag.ID] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// overlap is the cosine similarity of two sets of users.
+func overlap(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for id := range a {
+		if b[id] {
+			shared++
+		}
+	}
+	return float64(shared) / math.Sqrt(float64(len(a)*len(b)))
+}
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`about above after again against also because been before being below between both
+		cannot could does doing down during each from further have having here into itself just more most much must
+		only other over same should some such than that their them then there these they this those through under until
+		very what when where which while will with would your yours`) {
+		stopWords[w] = true
+	}
+}
+
+// termFrequencies counts the words of a post, the title counting twice.
+func termFrequencies(post structures.Blog) map[string]float64 {
+	terms := map[string]float64{}
+	add := func(text string, weight float64) {
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, w := range words {
+			if len([]rune(w)) > 3 && !stopWords[w] {
+				terms[w] += weight
+			}
+		}
+	}
+	add(post.Title, 2)
+	add(tools.PlainText(post.Desc), 1)
+	return terms
+}
+
+// cosine is the cosine similarity of two term vectors.
+func cosine(a, b map[string]float64) float64 {
+	var dot, na, nb float64
+	for term, x := range a {
+		na += x * x
+		if y, ok := b[term]; ok {
+			dot += x * y
+		}
+	}
+	for _, y := range b {
+		nb += y * y
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
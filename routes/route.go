@@ -8,40 +8,139 @@ import (
 
 func Setup(app *fiber.App) {
 	controller.LoadTemplates()
+
+	// Every route states its auth requirement: public routes use optional,
+	// which picks up the user when logged in, and writes use auth.
+	optional := middle.OptionalAuth
+	auth := middle.IsAuthenticate
+
 	app.Post("/api/register", controller.Register)
 	app.Post("/api/login", controller.Login)
 
-	app.Use(middle.IsAuthenticate)
+	// Syndication feeds are public; :format is rss, atom or json
+	app.Get("/feeds/:format", controller.SiteFeed)
+	app.Get("/feeds/users/:id/:format", controller.AuthorFeed)
+	app.Get("/feeds/tags/:slug/:format", controller.TagFeed)
+
+	// Crawlers: robots.txt and a sitemap index pointing at paginated sitemaps
+	app.Get("/robots.txt", controller.RobotsTxt)
+	app.Get("/sitemap.xml", controller.SitemapIndex)
+	app.Get("/sitemaps/posts-:page.xml", controller.PostSitemap)
+	app.Get("/sitemaps/authors-:page.xml", controller.AuthorSitemap)
 
+	app.Get("/posts/:id", optional, controller.RenderPostPage)
+	app.Get("/users/:id", optional, controller.RenderProfilePage)
 	app.Get("/login", controller.RenderLoginPage)
 	app.Get("/register", controller.RenderRegisterPage)
+	app.Get("/allPost", optional, controller.RenderAllPostPage)
+	app.Get("createBlog", auth, controller.RenderCreateBlogPage)
+
+	app.Get("/api/allpost", optional, controller.AllPost) // ?order=featured lists the featured posts first
+	app.Get("/api/allpost/:id", optional, controller.DetailPost)
+	app.Get("/api/featured", optional, controller.FeaturedPosts)
+	app.Get("/api/allpost/:id/related", optional, controller.RelatedPosts) // Posts related by tags, text and shared readers
+	app.Post("/api/posts", auth, controller.CreatePost)
+	app.Put("/api/updatepost/:id", auth, controller.UpdatePost)
+	app.Delete("/api/deletepost/:id", auth, controller.DeletePost)
+	app.Get("/api/uniquepost", auth, controller.UniquePost)
+	app.Get("/api/posts/followed", auth, controller.GetPostsFromFollowedUsers)
+	app.Get("/api/posts/:id/analytics", auth, controller.PostAnalytics) // Views, referrers and engagement trends for the authors
+
+	app.Post("/api/posts/:id/pin", auth, controller.PinPost) // Pin a post to its author's profile
+	app.Delete("/api/posts/:id/pin", auth, controller.UnpinPost)
+	app.Post("/api/posts/:id/feature", auth, controller.FeaturePost) // Feature a post site-wide (admins only)
+	app.Delete("/api/posts/:id/feature", auth, controller.UnfeaturePost)
+
+	app.Get("/api/posts/:id/authors", optional, controller.PostAuthors)
+	app.Post("/api/posts/:id/authors", auth, controller.InviteAuthor)           // Invite a co-author (owners only)
+	app.Delete("/api/posts/:id/authors/:userID", auth, controller.RemoveAuthor) // Remove a co-author, or leave the post
+	app.Get("/api/invitations", auth, controller.MyInvitations)                 // Pending co-author invitations
+	app.Post("/api/invitations/:inviteID/accept", auth, controller.AcceptInvitation)
+	app.Delete("/api/invitations/:inviteID", auth, controller.DeclineInvitation)
+
+	app.Post("/api/uploads", auth, controller.UploadImage)
+	app.Get("/api/media", auth, controller.MyMedia) // Media uploaded by the current user
+
+	app.Get("/api/user", auth, controller.GetUserInfo)
+	app.Delete("/api/user", auth, controller.DeleteUser) // Delete user account
+	app.Put("/api/user", auth, controller.UpdateUser)
+	app.Get("/api/users/:id", optional, controller.GetUserProfile)         // Public profile of a user
+	app.Get("/api/users/:id/lists", optional, controller.UserReadingLists) // Public reading lists of a user
+	app.Get("/api/users/:id/series", optional, controller.UserSeries)      // Series written by a user
+	app.Put("/api/users/:id/role", auth, controller.SetUserRole)           // Make a user a moderator or admin (admins only)
+
+	app.Get("/api/post/:id/comments", optional, controller.ReadComments)        // Retrieve all comments for a blog post
+	app.Post("/api/post/:id/comment", auth, controller.CreateComment)           // Create a new comment for a blog post
+	app.Put("/api/post/:id/comment/:commentID", auth, controller.UpdateComment) // Update a specific comment
+	app.Delete("/api/post/:id/comment/:commentID", auth, controller.DeleteComment)
+	app.Get("/api/post/:id/comment/:commentID/history", auth, controller.CommentHistory) // Prior versions of an edited comment, for moderators
+
+	app.Get("/api/moderation/comments", auth, controller.ModerationQueue) // Held comments on your posts, or everywhere for moderators
+	app.Post("/api/moderation/comments/:commentID/approve", auth, controller.ApproveComment)
+	app.Post("/api/moderation/comments/:commentID/reject", auth, controller.RejectComment)
+	app.Post("/api/moderation/comments/:commentID/ban", auth, controller.BanCommenter) // Reject and ban the commenter
+	app.Get("/api/moderation/bans", auth, controller.ListBans)
+	app.Delete("/api/moderation/bans/:banID", auth, controller.LiftBan)
+	app.Get("/api/moderation/posts", auth, controller.PostQueue) // Posts held as spam, moderators only
+	app.Post("/api/moderation/posts/:id/approve", auth, controller.ApprovePost)
+	app.Post("/api/moderation/posts/:id/reject", auth, controller.RejectPost)
+	app.Get("/api/moderation/reports", auth, controller.ReportQueue) // Reports by status, type and reason, moderators only
+	app.Get("/api/moderation/reports/:reportID", auth, controller.GetReport)
+	app.Put("/api/moderation/reports/:reportID", auth, controller.ResolveReport) // Move reports to reviewing, resolved or dismissed
+
+	app.Post("/api/posts/:id/report", auth, controller.ReportPost)
+	app.Post("/api/post/:id/comment/:commentID/report", auth, controller.ReportComment)
+	app.Post("/api/users/:id/report", auth, controller.ReportUser)
 
-	app.Get("createBlog", controller.RenderCreateBlogPage)
-	app.Post("/api/posts", controller.CreatePost)
+	app.Get("/api/reactions", optional, controller.ReactionTypes)
+	app.Get("/api/post/:id/reactions", optional, controller.PostReactions)                               // List who reacted to a blog post
+	app.Get("/api/post/:id/comment/:commentID/reactions", optional, controller.CommentReactions)         // List who reacted to a comment
+	app.Post("/api/post/:id/reactions/:type", auth, controller.TogglePostReaction)                       // Toggle a reaction on a blog post
+	app.Post("/api/post/:id/comment/:commentID/reactions/:type", auth, controller.ToggleCommentReaction) // Toggle a reaction on a comment
 
-	app.Get("/allPost", controller.RenderAllPostPage)
-	app.Get("/api/allpost", controller.AllPost)
-	app.Get("/api/allpost/:id", controller.DetailPost)
+	app.Get("/api/bookmarks", auth, controller.ListBookmarks)
+	app.Post("/api/bookmarks/:id", auth, controller.AddBookmark)      // Bookmark a blog post
+	app.Delete("/api/bookmarks/:id", auth, controller.RemoveBookmark) // Remove a blog post from bookmarks
 
-	app.Put("/api/updatepost/:id", controller.UpdatePost)
+	app.Get("/api/lists", auth, controller.MyReadingLists)
+	app.Post("/api/lists", auth, controller.CreateReadingList)
+	app.Get("/api/lists/:listID", optional, controller.GetReadingList)
+	app.Put("/api/lists/:listID", auth, controller.UpdateReadingList)
+	app.Delete("/api/lists/:listID", auth, controller.DeleteReadingList)
+	app.Put("/api/lists/:listID/order", auth, controller.ReorderReadingList)           // Reorder the posts of a reading list
+	app.Post("/api/lists/:listID/posts/:id", auth, controller.AddToReadingList)        // Append a blog post to a reading list
+	app.Delete("/api/lists/:listID/posts/:id", auth, controller.RemoveFromReadingList) // Remove a blog post from a reading list
 
-	app.Get("/api/uniquepost", controller.UniquePost)
-	app.Delete("/api/deletepost/:id", controller.DeletePost)
-	app.Post("/api/uploads", controller.UploadImage)
+	app.Get("/api/series", auth, controller.MySeries)
+	app.Post("/api/series", auth, controller.CreateSeries)
+	app.Get("/api/series/:seriesID", optional, controller.GetSeries) // Series landing: the series and its posts in order
+	app.Put("/api/series/:seriesID", auth, controller.UpdateSeries)
+	app.Delete("/api/series/:seriesID", auth, controller.DeleteSeries)
+	app.Put("/api/series/:seriesID/order", auth, controller.ReorderSeries)           // Reorder the posts of a series
+	app.Post("/api/series/:seriesID/posts/:id", auth, controller.AddToSeries)        // Append one of your posts to a series
+	app.Delete("/api/series/:seriesID/posts/:id", auth, controller.RemoveFromSeries) // Remove a post from a series
 
-	app.Get("/api/user", controller.GetUserInfo)
-	app.Delete("/api/user", controller.DeleteUser) // Delete user account
-	app.Put("/api/user", controller.UpdateUser)
+	app.Get("/api/export", auth, controller.ExportContent)  // Download posts, comments and tags as an archive
+	app.Post("/api/import", auth, controller.ImportContent) // Import an archive produced by export
 
-	app.Post("/api/post/:id/comment", controller.CreateComment)           // Create a new comment for a blog post
-	app.Get("/api/post/:id/comments", controller.ReadComments)            // Retrieve all comments for a blog post
-	app.Put("/api/post/:id/comment/:commentID", controller.UpdateComment) // Update a specific comment
-	app.Delete("/api/post/:id/comment/:commentID", controller.DeleteComment)
+	app.Post("/api/follow/:id", auth, controller.FollowUser)
+	app.Delete("/api/unfollow/:id", auth, controller.UnfollowUser)
+	app.Get("/api/users/:id/followers", optional, controller.Followers)
+	app.Get("/api/users/:id/following", optional, controller.Following)
+	app.Post("/api/users/:id/block", auth, controller.BlockUser) // Stop a user's mentions from notifying you
+	app.Delete("/api/users/:id/block", auth, controller.UnblockUser)
+	app.Get("/api/blocks", auth, controller.MyBlocks)
 
-	app.Post("/api/follow/:id", controller.FollowUser)
-	app.Delete("/api/unfollow/:id", controller.UnfollowUser)
+	app.Get("/api/notifications", auth, controller.MyNotifications)
+	app.Get("/api/notifications/unread", auth, controller.UnreadNotifications) // Unread counts, in total and per type
+	app.Post("/api/notifications/read", auth, controller.ReadAllNotifications)
+	app.Post("/api/notifications/:notificationID/read", auth, controller.ReadNotification)
+	app.Get("/api/notifications/preferences", auth, controller.NotificationPreferences)
+	app.Put("/api/notifications/preferences", auth, controller.UpdateNotificationPreferences) // Turn notification types on or off
 
-	app.Get("/api/posts/followed", controller.GetPostsFromFollowedUsers)
+	app.Get("/api/stream", auth, controller.StreamEvents)                         // Server-Sent Events: followed posts, notifications
+	app.Get("/api/post/:id/comments/stream", optional, controller.StreamComments) // Server-Sent Events: new comments on a post
+	app.Get("/api/ws", auth, controller.Socket)                                   // WebSocket carrying the same events
 
 	app.Static("/api/uploads", "./uploads")
 }
@@ -0,0 +1,150 @@
+package spam
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// interestingTokens is the number of tokens, the farthest from neutral, the
+// classifier combines into a score.
+const interestingTokens = 15
+
+// maxTokenLength is the longest token stored, in bytes.
+const maxTokenLength = 64
+
+// tokenize splits text into the lowercased words the classifier learns
+// from, plus one "host:" token per linked host. Each token appears once.
+func tokenize(text string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if len(token) > maxTokenLength {
+			// Cut on a rune boundary, the database only takes valid UTF-8
+			token = token[:maxTokenLength]
+			for !utf8.ValidString(token) {
+				token = token[:len(token)-1]
+			}
+		}
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := len([]rune(word)); n >= 3 && n <= 32 {
+			add(word)
+		}
+	}
+	for _, link := range links(text) {
+		if host := linkHost(link); host != "" {
+			add("host:" + host)
+		}
+	}
+	return tokens
+}
+
+// Train teaches the classifier that text is spam, or ham when spam is
+// false. Moderators train it by approving and rejecting held content.
+func Train(text string, spam bool) error {
+	var spamCount, hamCount int64 = 0, 1
+	if spam {
+		spamCount, hamCount = 1, 0
+	}
+	rows := []structures.SpamToken{{Token: structures.SpamDocs, Spam: spamCount, Ham: hamCount}}
+	for _, token := range tokenize(text) {
+		rows = append(rows, structures.SpamToken{Token: token, Spam: spamCount, Ham: hamCount})
+	}
+	return db.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"spam": gorm.Expr("spam + VALUES(spam)"),
+			"ham":  gorm.Expr("ham + VALUES(ham)"),
+		}),
+	}).Create(&rows).Error
+}
+
+// Classifier is a naive Bayesian filter over the tokens of the content. It
+// flags content scoring at least SPAM_BAYES_THRESHOLD percent (default 90),
+// once it was trained on SPAM_BAYES_MIN_DOCS (default 10) documents of
+// each kind.
+type Classifier struct{}
+
+func (Classifier) Check(content Content) Verdict {
+	score, ok := Score(content.Text())
+	if !ok {
+		return Verdict{}
+	}
+	verdict := Verdict{Score: score}
+	if score*100 >= float64(tools.EnvInt("SPAM_BAYES_THRESHOLD", 90)) {
+		verdict.Spam = true
+		verdict.Reasons = []string{"classifier score " + strconv.FormatFloat(score, 'f', 2, 64)}
+	}
+	return verdict
+}
+
+// Score returns the probability that text is spam. ok is false while the
+// classifier hasn't been trained enough to tell.
+func Score(text string) (score float64, ok bool) {
+	var docs structures.SpamToken
+	if err := db.DB.Where("token = ?", structures.SpamDocs).First(&docs).Error; err != nil {
+		return 0, false
+	}
+	min := int64(tools.EnvInt("SPAM_BAYES_MIN_DOCS", 10))
+	if docs.Spam < min || docs.Ham < min {
+		return 0, false
+	}
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return 0, false
+	}
+	var known []structures.SpamToken
+	db.DB.Where("token IN ?", tokens).Find(&known)
+	return combine(docs, known)
+}
+
+// combine scores the known tokens of a text given the number of spam and
+// ham documents trained. ok is false when no token tells anything.
+func combine(docs structures.SpamToken, known []structures.SpamToken) (score float64, ok bool) {
+	// Per-token probabilities with Robinson's correction, so that rare
+	// tokens stay close to neutral
+	probabilities := make([]float64, 0, len(known))
+	for _, token := range known {
+		s := float64(token.Spam) / float64(docs.Spam)
+		h := float64(token.Ham) / float64(docs.Ham)
+		if s+h == 0 {
+			continue
+		}
+		n := float64(token.Spam + token.Ham)
+		p := (0.5 + n*s/(s+h)) / (1 + n)
+		probabilities = append(probabilities, math.Min(math.Max(p, 0.01), 0.99))
+	}
+	if len(probabilities) == 0 {
+		return 0, false
+	}
+	sort.Slice(probabilities, func(i, j int) bool {
+		return math.Abs(probabilities[i]-0.5) > math.Abs(probabilities[j]-0.5)
+	})
+	if len(probabilities) > interestingTokens {
+		probabilities = probabilities[:interestingTokens]
+	}
+
+	// Combined in log space: spam / (spam + ham)
+	var logSpam, logHam float64
+	for _, p := range probabilities {
+		logSpam += math.Log(p)
+		logHam += math.Log(1 - p)
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam)), true
+}
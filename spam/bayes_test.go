@@ -0,0 +1,76 @@
+package spam
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aizeresalim/final/structures"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Buy CHEAP pills, buy cheap pills now at https://www.Pills.example/x ok")
+	want := []string{"buy", "cheap", "pills", "now", "https", "www", "example", "host:pills.example"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestTokenizeLength(t *testing.T) {
+	if got := tokenize("ab " + strings.Repeat("x", 33)); len(got) != 0 {
+		t.Fatalf("words under 3 or over 32 runes should be dropped, got %q", got)
+	}
+	// 32 runes is a word, even when it doesn't fit in a token
+	for _, word := range []string{strings.Repeat("漢", 32), strings.Repeat("𐐨", 20), strings.Repeat("é", 32)} {
+		tokens := tokenize(word)
+		if len(tokens) != 1 {
+			t.Fatalf("tokenize(%q) = %q", word, tokens)
+		}
+		if token := tokens[0]; len(token) > maxTokenLength || !utf8.ValidString(token) || !strings.HasPrefix(word, token) {
+			t.Fatalf("token %q of %q is not a valid prefix of at most %d bytes", token, word, maxTokenLength)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+	docs := structures.SpamToken{Token: structures.SpamDocs, Spam: 100, Ham: 100}
+	spammy := []structures.SpamToken{{Token: "viagra", Spam: 90, Ham: 1}, {Token: "casino", Spam: 80, Ham: 2}}
+	hammy := []structures.SpamToken{{Token: "golang", Spam: 1, Ham: 70}, {Token: "review", Spam: 2, Ham: 60}}
+
+	if score, ok := combine(docs, spammy); !ok || score < 0.9 {
+		t.Fatalf("spammy tokens scored %v, %v", score, ok)
+	}
+	if score, ok := combine(docs, hammy); !ok || score > 0.1 {
+		t.Fatalf("hammy tokens scored %v, %v", score, ok)
+	}
+	if score, ok := combine(docs, append(spammy, hammy...)); !ok || score < 0.1 || score > 0.9 {
+		t.Fatalf("mixed tokens scored %v, %v", score, ok)
+	}
+	if _, ok := combine(docs, []structures.SpamToken{{Token: "never", Spam: 0, Ham: 0}}); ok {
+		t.Fatal("tokens never seen should tell nothing")
+	}
+}
+
+func TestCombineRareTokensStayNeutral(t *testing.T) {
+	docs := structures.SpamToken{Token: structures.SpamDocs, Spam: 100, Ham: 100}
+	score, ok := combine(docs, []structures.SpamToken{{Token: "once", Spam: 1, Ham: 0}})
+	if !ok || score > 0.8 {
+		t.Fatalf("a token seen once scored %v, %v", score, ok)
+	}
+}
+
+func TestCombineUsesMostInterestingTokens(t *testing.T) {
+	docs := structures.SpamToken{Token: structures.SpamDocs, Spam: 100, Ham: 100}
+	var known []structures.SpamToken
+	for i := 0; i < interestingTokens; i++ {
+		known = append(known, structures.SpamToken{Token: "spam" + string(rune('a'+i)), Spam: 95, Ham: 1})
+	}
+	// Many mildly hammy tokens are outweighed by the strongest ones
+	for i := 0; i < 50; i++ {
+		known = append(known, structures.SpamToken{Token: "ham" + string(rune('a'+i)), Spam: 40, Ham: 50})
+	}
+	if score, ok := combine(docs, known); !ok || score < 0.99 {
+		t.Fatalf("score %v, %v", score, ok)
+	}
+}
@@ -0,0 +1,155 @@
+package spam
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s()<>"'\]]+|\bwww\.[^\s()<>"'\]]+`)
+
+// links returns the links found in text.
+func links(text string) []string {
+	return linkPattern.FindAllString(text, -1)
+}
+
+// linkHost returns the lowercased host of a link, without "www.".
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// envList reads a comma-separated list setting, lowercased.
+func envList(name string) []string {
+	var list []string
+	for _, item := range strings.Split(tools.EnvString(name, ""), ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// flagged is the verdict of a heuristic that found spam.
+func flagged(reason string) Verdict {
+	return Verdict{Spam: true, Score: 1, Reasons: []string{reason}}
+}
+
+// LinkCount flags content with more links than SPAM_MAX_COMMENT_LINKS
+// (default 3) for comments or SPAM_MAX_POST_LINKS (default 20) for posts.
+type LinkCount struct{}
+
+func (LinkCount) Check(content Content) Verdict {
+	max := tools.EnvInt("SPAM_MAX_COMMENT_LINKS", 3)
+	if content.Kind == KindPost {
+		max = tools.EnvInt("SPAM_MAX_POST_LINKS", 20)
+	}
+	if count := len(links(content.Text())); count > max {
+		return flagged(strconv.Itoa(count) + " links")
+	}
+	return Verdict{}
+}
+
+// Blocklist flags content linking to a domain in SPAM_BLOCKED_DOMAINS, or to
+// one of its subdomains, and content containing a word or phrase from
+// SPAM_BLOCKED_WORDS. Both are comma-separated lists.
+type Blocklist struct{}
+
+func (Blocklist) Check(content Content) Verdict {
+	var verdict Verdict
+	domains := envList("SPAM_BLOCKED_DOMAINS")
+	for _, link := range links(content.Text()) {
+		host := linkHost(link)
+		for _, domain := range domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				verdict = flagged("blocked domain " + domain)
+			}
+		}
+	}
+
+	words := tokenize(content.Text())
+	seen := map[string]bool{}
+	for _, word := range words {
+		seen[word] = true
+	}
+	lower := strings.ToLower(content.Text())
+	for _, blocked := range envList("SPAM_BLOCKED_WORDS") {
+		// Phrases match anywhere, single words only as whole words
+		if seen[blocked] || (strings.Contains(blocked, " ") && strings.Contains(lower, blocked)) {
+			verdict.Spam, verdict.Score = true, 1
+			verdict.Reasons = append(verdict.Reasons, "blocked word "+strconv.Quote(blocked))
+		}
+	}
+	return verdict
+}
+
+// Duplicate flags content identical to what the same user posted within
+// SPAM_DUPLICATE_HOURS (default 24), or to what other users posted in that
+// time when it is long enough not to be a common phrase.
+type Duplicate struct{}
+
+// minSharedLength is the length from which identical content from different
+// users counts as duplicated.
+const minSharedLength = 40
+
+func (Duplicate) Check(content Content) Verdict {
+	body := strings.TrimSpace(content.Body)
+	if body == "" {
+		return Verdict{}
+	}
+	since := time.Now().Add(-time.Duration(tools.EnvInt("SPAM_DUPLICATE_HOURS", 24)) * time.Hour)
+
+	query := db.DB.Model(&structures.Comment{}).Where("content = ? AND date_time >= ?", body, since)
+	if content.Kind == KindPost {
+		query = db.DB.Model(&structures.Blog{}).Where("`desc` = ? AND created_at >= ?", body, since)
+	}
+	if content.ID != 0 {
+		query = query.Where("id <> ?", content.ID)
+	}
+	if len(body) < minSharedLength {
+		query = query.Where("user_id = ?", content.UserID)
+	}
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		return flagged("duplicate " + content.Kind)
+	}
+	return Verdict{}
+}
+
+// Velocity flags users writing faster than SPAM_COMMENT_RATE (default 5)
+// comments or SPAM_POST_RATE (default 3) posts within SPAM_RATE_MINUTES
+// (default 10). Edits are not counted.
+type Velocity struct{}
+
+func (Velocity) Check(content Content) Verdict {
+	if content.ID != 0 || content.UserID == "" {
+		return Verdict{}
+	}
+	since := time.Now().Add(-time.Duration(tools.EnvInt("SPAM_RATE_MINUTES", 10)) * time.Minute)
+
+	var count int64
+	limit := tools.EnvInt("SPAM_COMMENT_RATE", 5)
+	if content.Kind == KindPost {
+		limit = tools.EnvInt("SPAM_POST_RATE", 3)
+		db.DB.Model(&structures.Blog{}).Where("user_id = ? AND created_at >= ?", content.UserID, since).Count(&count)
+	} else {
+		db.DB.Model(&structures.Comment{}).Where("user_id = ? AND date_time >= ?", content.UserID, since).Count(&count)
+	}
+	if count >= int64(limit) {
+		return flagged("posting too fast")
+	}
+	return Verdict{}
+}
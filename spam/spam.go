@@ -0,0 +1,91 @@
+// Package spam screens comments and posts before they are published. Each
+// Checker looks at one signal; the combined verdict tells the controllers to
+// hold the content in the moderation queue. The built-in checkers are cheap
+// heuristics plus a Bayesian classifier trained from moderator decisions.
+package spam
+
+import (
+	"strings"
+	"sync"
+)
+
+// Kinds of content checked.
+const (
+	KindComment = "comment"
+	KindPost    = "post"
+)
+
+// Content is a comment or post about to be saved.
+type Content struct {
+	Kind   string
+	UserID string
+	// ID is set when existing content is edited, so that it isn't compared
+	// with itself or counted as new.
+	ID    uint
+	Title string
+	Body  string
+}
+
+// Text is the title and body of the content together.
+func (c Content) Text() string {
+	if c.Title == "" {
+		return c.Body
+	}
+	return c.Title + "\n" + c.Body
+}
+
+// Verdict is the outcome of a check. Score is between 0 and 1; Reasons says
+// why content was found to be spam, for moderators.
+type Verdict struct {
+	Spam    bool     `json:"spam"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Reason joins the reasons of the verdict for storage.
+func (v Verdict) Reason() string {
+	return strings.Join(v.Reasons, "; ")
+}
+
+// Checker looks at content for one kind of spam signal.
+type Checker interface {
+	Check(content Content) Verdict
+}
+
+var (
+	mu       sync.RWMutex
+	checkers = []Checker{
+		LinkCount{},
+		Blocklist{},
+		Duplicate{},
+		Velocity{},
+		Classifier{},
+	}
+)
+
+// Register adds a checker run on every piece of content after the built-in
+// ones.
+func Register(checker Checker) {
+	mu.Lock()
+	checkers = append(checkers, checker)
+	mu.Unlock()
+}
+
+// Check runs every checker on the content. The content is spam as soon as
+// one checker says so; the score is the highest one.
+func Check(content Content) Verdict {
+	mu.RLock()
+	defer mu.RUnlock()
+	var verdict Verdict
+	for _, checker := range checkers {
+		v := checker.Check(content)
+		if v.Score > verdict.Score {
+			verdict.Score = v.Score
+		}
+		if v.Spam {
+			verdict.Spam = true
+			verdict.Reasons = append(verdict.Reasons, v.Reasons...)
+		}
+	}
+	return verdict
+}
@@ -0,0 +1,21 @@
+package structures
+
+import "time"
+
+// PostDailyStat holds the deduplicated view count of a post for one day.
+type PostDailyStat struct {
+	ID     uint      `json:"-" gorm:"primaryKey"`
+	PostID uint      `json:"post_id" gorm:"uniqueIndex:idx_post_day"`
+	Day    time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_post_day"`
+	Views  int64     `json:"views"`
+}
+
+// PostReferrerStat counts the views a post got from one referring host on
+// one day. Views without a referrer are stored under the "direct" host.
+type PostReferrerStat struct {
+	ID     uint      `json:"-" gorm:"primaryKey"`
+	PostID uint      `json:"post_id" gorm:"uniqueIndex:idx_post_day_host"`
+	Day    time.Time `json:"day" gorm:"type:date;uniqueIndex:idx_post_day_host"`
+	Host   string    `json:"host" gorm:"size:191;uniqueIndex:idx_post_day_host"`
+	Views  int64     `json:"views"`
+}
@@ -1,9 +1,116 @@
 package structures
 
+import "time"
+
+// Post visibility levels.
+const (
+	VisibilityPublic    = "public"    // listed and readable by everyone
+	VisibilityUnlisted  = "unlisted"  // readable by link, left out of listings
+	VisibilityFollowers = "followers" // readable by the author's followers
+	VisibilityPrivate   = "private"   // readable by the author only
+)
+
+// Post statuses. Posts held as spam wait in the moderation queue and are
+// only shown to their authors until approved.
+const (
+	PostApproved = "approved"
+	PostPending  = "pending"
+	PostRejected = "rejected"
+)
+
+// Comment access levels, set per post by its authors.
+const (
+	CommentsOpen      = "open"      // anyone who can read the post comments
+	CommentsLocked    = "locked"    // comments stay visible, no new ones
+	CommentsDisabled  = "disabled"  // comments are hidden and closed
+	CommentsFollowers = "followers" // only the writer's followers comment
+)
+
 type Blog struct {
-	Id     uint   `json:"id"`
-	Title  string `json:"title"`
-	Desc   string `json:"desc"`
-	UserID string `json:"userid"`
-	User   User   `json:"user";gorm:"foreignkey:UserID"`
+	Id         uint      `json:"id"`
+	Title      string    `json:"title"`
+	Desc       string    `json:"desc,omitempty"`
+	UserID     string    `json:"userid"`
+	User       User      `json:"user" gorm:"foreignkey:UserID"`
+	Visibility string    `json:"visibility" gorm:"size:16;default:public;index"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	// Excerpt, WordCount and ReadingMinutes are computed from Desc on save.
+	// List endpoints return the excerpt in place of the body.
+	Excerpt        string `json:"excerpt" gorm:"type:text"`
+	WordCount      int    `json:"word_count"`
+	ReadingMinutes int    `json:"reading_minutes"`
+
+	// Status is approved, or pending/rejected for posts held as spam;
+	// HeldReason tells moderators why a post was held.
+	Status     string `json:"status" gorm:"size:16;default:approved;index"`
+	HeldReason string `json:"held_reason,omitempty" gorm:"size:255"`
+
+	// CommentAccess tells who can comment on the post.
+	CommentAccess string `json:"comment_access" form:"comment_access" gorm:"size:16;default:open"`
+
+	// CommentModeration overrides the site's comment moderation mode for
+	// this post when set.
+	CommentModeration string `json:"comment_moderation" gorm:"size:24"`
+
+	// PinnedAt is set while the post is pinned to its author's profile.
+	// FeaturedUntil is set by admins to feature the post site-wide until
+	// then; Featured tells whether that is still the case.
+	PinnedAt      *time.Time `json:"pinned_at" gorm:"index"`
+	FeaturedUntil *time.Time `json:"featured_until" gorm:"index"`
+	Featured      bool       `json:"featured" gorm:"-"`
+
+	// Authors lists every author of the post, the original writer first. It
+	// is filled in by the controllers from PostAuthor.
+	Authors []PostAuthor `json:"authors" gorm:"-"`
+
+	// Tags is filled from TagNames when a post is saved.
+	Tags     []Tag    `json:"tags" gorm:"many2many:post_tags;"`
+	TagNames []string `json:"tag_names,omitempty" form:"tag_names" gorm:"-"`
+
+	// CoverMediaID points at the cover image. MediaIDs lists the inline
+	// media of the post; it is stored in PostMedia.
+	CoverMediaID *uint   `json:"cover_media_id"`
+	MediaIDs     []uint  `json:"media_ids" form:"media_ids" gorm:"-"`
+	Cover        *Media  `json:"cover,omitempty" gorm:"-"`
+	Media        []Media `json:"media,omitempty" gorm:"-"`
+
+	// Reactions holds the per-type reaction counts; it is filled in by the
+	// controllers and never stored.
+	Reactions   map[string]int64 `json:"reactions" gorm:"-"`
+	MyReactions []string         `json:"my_reactions" gorm:"-"`
+
+	// Bookmarked tells the current user whether they saved the post.
+	Bookmarked bool `json:"bookmarked" gorm:"-"`
+
+	// Views is the total view count, only filled in for the author.
+	Views *int64 `json:"views,omitempty" gorm:"-"`
+
+	// Mentions lists the users @mentioned in Desc, filled in on the detail
+	// view.
+	Mentions []Mention `json:"mentions,omitempty" gorm:"-"`
+
+	// Series is the previous/next navigation of the series the post is part
+	// of, filled in on the detail view.
+	Series *SeriesNav `json:"series,omitempty" gorm:"-"`
+}
+
+// ValidVisibility reports whether v is one of the known visibility levels.
+func ValidVisibility(v string) bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityFollowers, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// ValidCommentAccess reports whether a is one of the known comment access
+// levels.
+func ValidCommentAccess(a string) bool {
+	switch a {
+	case CommentsOpen, CommentsLocked, CommentsDisabled, CommentsFollowers:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,36 @@
+package structures
+
+import "time"
+
+// Bookmark is a private "read later" marker a user puts on a post.
+type Bookmark struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"size:64;uniqueIndex:idx_bookmark_unique"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_bookmark_unique"`
+	CreatedAt time.Time `json:"created_at"`
+	Post      Blog      `json:"post" gorm:"foreignkey:PostID"`
+}
+
+// ReadingList is a named, ordered collection of posts. Lists are private to
+// their owner unless Public is set.
+type ReadingList struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	UserID      string            `json:"user_id" gorm:"size:64;index"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Public      bool              `json:"public"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	User        User              `json:"user" gorm:"foreignkey:UserID"`
+	Items       []ReadingListItem `json:"items,omitempty" gorm:"foreignkey:ListID"`
+}
+
+// ReadingListItem places a post at a position inside a reading list.
+type ReadingListItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ListID    uint      `json:"list_id" gorm:"uniqueIndex:idx_list_item_unique"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_list_item_unique"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	Post      Blog      `json:"post" gorm:"foreignkey:PostID"`
+}
@@ -0,0 +1,37 @@
+package structures
+
+import "time"
+
+// Author roles on a post. Owners can edit and delete the post and manage
+// its authors; editors can only edit it. The user who wrote the post
+// (Blog.UserID) is always an owner.
+const (
+	AuthorRoleOwner  = "owner"
+	AuthorRoleEditor = "editor"
+)
+
+// Invitation states of a PostAuthor.
+const (
+	AuthorPending  = "pending"
+	AuthorAccepted = "accepted"
+)
+
+// PostAuthor makes a user a co-author of a post. It starts as a pending
+// invitation and counts once the invited user accepts it.
+type PostAuthor struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PostID    uint      `json:"post_id" gorm:"uniqueIndex:idx_post_author"`
+	UserID    string    `json:"user_id" gorm:"size:64;uniqueIndex:idx_post_author;index"`
+	Role      string    `json:"role" gorm:"size:16"`
+	Status    string    `json:"status" gorm:"size:16;default:pending"`
+	InvitedBy string    `json:"invited_by" gorm:"size:64"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	User      User      `json:"user" gorm:"foreignkey:UserID"`
+	Post      *Blog     `json:"post,omitempty" gorm:"foreignkey:PostID"`
+}
+
+// ValidAuthorRole reports whether role is one of the known author roles.
+func ValidAuthorRole(role string) bool {
+	return role == AuthorRoleOwner || role == AuthorRoleEditor
+}
@@ -2,6 +2,14 @@ package structures
 
 import "time"
 
+// Comment statuses. Held comments wait in the moderation queue and are only
+// shown to their author until approved.
+const (
+	CommentApproved = "approved"
+	CommentPending  = "pending"
+	CommentRejected = "rejected"
+)
+
 // Comment represents a comment made by a user on a blog post.
 type Comment struct {
 	ID       uint      `json:"id"`
@@ -9,5 +17,50 @@ type Comment struct {
 	PostID   uint      `json:"post_id"`
 	Content  string    `json:"content"`
 	DateTime time.Time `json:"datetime"`
-	User     User      `json:"user";gorm:"foreignkey:UserID"`
+	User     User      `json:"user" gorm:"foreignkey:UserID"`
+
+	// ParentID is the comment this one replies to, nil for top-level
+	// comments. Depth is 0 for top-level comments and ReplyCount counts the
+	// direct replies.
+	ParentID   *uint `json:"parent_id" gorm:"index"`
+	Depth      int   `json:"depth"`
+	ReplyCount int   `json:"reply_count"`
+
+	// Status is approved, or pending/rejected for moderated comments;
+	// HeldReason tells moderators why a comment was held as spam.
+	Status     string `json:"status" gorm:"size:16;default:approved;index"`
+	HeldReason string `json:"held_reason,omitempty" gorm:"size:255"`
+
+	// Edited is set once the author changed the comment, last at EditedAt.
+	// The versions it replaced are kept as CommentRevisions.
+	Edited   bool       `json:"edited"`
+	EditedAt *time.Time `json:"edited_at"`
+
+	// Deleted marks a tombstone: a deleted comment kept, without its
+	// content or author, so that its replies stay in place.
+	Deleted bool `json:"deleted"`
+
+	// Path lists the IDs from the top-level comment down to this one, and
+	// Replies holds the nested replies; both are filled in when reading.
+	Path    string    `json:"path,omitempty" gorm:"-"`
+	Replies []Comment `json:"replies,omitempty" gorm:"-"`
+
+	// Mentions lists the users @mentioned in Content, filled in when
+	// reading.
+	Mentions []Mention `json:"mentions,omitempty" gorm:"-"`
+
+	// Reactions holds the per-type reaction counts; it is filled in by the
+	// controllers and never stored.
+	Reactions   map[string]int64 `json:"reactions" gorm:"-"`
+	MyReactions []string         `json:"my_reactions" gorm:"-"`
+}
+
+// CommentRevision is a version of a comment replaced by an edit, kept for
+// moderators. CreatedAt is when it was replaced.
+type CommentRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CommentID uint      `json:"comment_id" gorm:"index"`
+	Content   string    `json:"content" gorm:"type:text"`
+	EditedBy  string    `json:"edited_by" gorm:"size:64"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -1,7 +1,10 @@
 package structures
 
+import "time"
+
 type Follow struct {
-	ID             uint `json:"id" gorm:"primaryKey"`
-	FollowerID     uint `json:"follower_id"`
-	FollowedUserID uint `json:"followed_user_id"`
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	FollowerID     uint      `json:"follower_id" gorm:"index"`
+	FollowedUserID uint      `json:"followed_user_id" gorm:"index"`
+	CreatedAt      time.Time `json:"created_at"`
 }
@@ -0,0 +1,15 @@
+package structures
+
+// ImportRecord remembers which local row an imported item became, so that
+// running the same import again doesn't create duplicates.
+type ImportRecord struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// ImportedBy is the user who ran the import through the API, or empty
+	// for imports run from the command line. Records are only reused by the
+	// same importer, since anyone can claim any origin in an archive.
+	ImportedBy string `json:"imported_by" gorm:"size:64;uniqueIndex:idx_import_record"`
+	Origin     string `json:"origin" gorm:"size:191;uniqueIndex:idx_import_record"`
+	Kind       string `json:"kind" gorm:"size:16;uniqueIndex:idx_import_record"`
+	SourceID   string `json:"source_id" gorm:"size:191;uniqueIndex:idx_import_record"`
+	TargetID   uint   `json:"target_id"`
+}
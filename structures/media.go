@@ -0,0 +1,28 @@
+package structures
+
+import "time"
+
+// Media is a file uploaded through UploadImage. It belongs to the user who
+// uploaded it and can be attached to that user's posts.
+type Media struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       string    `json:"user_id" gorm:"size:64;index"`
+	FileName     string    `json:"file_name"`
+	OriginalName string    `json:"original_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// URL is resolved by the controllers and never stored.
+	URL string `json:"url" gorm:"-"`
+}
+
+// PostMedia attaches an inline media item to a post.
+type PostMedia struct {
+	ID       uint `json:"id" gorm:"primaryKey"`
+	PostID   uint `json:"post_id" gorm:"uniqueIndex:idx_post_media"`
+	MediaID  uint `json:"media_id" gorm:"uniqueIndex:idx_post_media"`
+	Position int  `json:"position"`
+}
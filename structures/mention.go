@@ -0,0 +1,20 @@
+package structures
+
+import "time"
+
+// Mention is an @handle in a post or comment resolved to its user.
+type Mention struct {
+	Handle string `json:"handle"`
+	UserID string `json:"user_id"`
+	URL    string `json:"url"`
+}
+
+// Block records that a user blocked another one. Blocked users don't reach
+// the blocker through mentions and other notifications.
+type Block struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"size:64;uniqueIndex:idx_block"`
+	BlockedID string    `json:"blocked_id" gorm:"size:64;uniqueIndex:idx_block"`
+	CreatedAt time.Time `json:"created_at"`
+	Blocked   User      `json:"blocked" gorm:"foreignkey:BlockedID"`
+}
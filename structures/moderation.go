@@ -0,0 +1,36 @@
+package structures
+
+import "time"
+
+// Comment moderation modes, set per site and optionally per post.
+const (
+	// ModerationOpen publishes comments right away.
+	ModerationOpen = "open"
+	// ModerationFirstHeld holds comments from users who have no approved
+	// comment yet.
+	ModerationFirstHeld = "first-comment-held"
+	// ModerationAllHeld holds every comment for review.
+	ModerationAllHeld = "all-held"
+	// ModerationClosed accepts no new comments.
+	ModerationClosed = "closed"
+)
+
+// ValidModeration reports whether mode is one of the known moderation modes.
+func ValidModeration(mode string) bool {
+	switch mode {
+	case ModerationOpen, ModerationFirstHeld, ModerationAllHeld, ModerationClosed:
+		return true
+	}
+	return false
+}
+
+// CommentBan stops a user from commenting. AuthorID limits the ban to the
+// posts of that author; an empty AuthorID bans the user site-wide.
+type CommentBan struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    string    `json:"user_id" gorm:"size:64;uniqueIndex:idx_comment_ban"`
+	AuthorID  string    `json:"author_id" gorm:"size:64;uniqueIndex:idx_comment_ban"`
+	BannedBy  string    `json:"banned_by" gorm:"size:64"`
+	CreatedAt time.Time `json:"created_at"`
+	User      User      `json:"user" gorm:"foreignkey:UserID"`
+}
@@ -0,0 +1,54 @@
+package structures
+
+import "time"
+
+// Notification types.
+const (
+	NotificationMention = "mention" // mentioned in a post or comment
+	NotificationFollow  = "follow"  // followed by another user
+	NotificationComment = "comment" // comment on a post the user wrote
+	NotificationReply   = "reply"   // reply to a comment of the user
+)
+
+// NotificationTypes lists every notification type, for preferences.
+var NotificationTypes = []string{
+	NotificationMention,
+	NotificationFollow,
+	NotificationComment,
+	NotificationReply,
+}
+
+// ValidNotificationType reports whether t is one of the known notification
+// types.
+func ValidNotificationType(t string) bool {
+	for _, known := range NotificationTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Notification tells a user about something another user did. PostID and
+// CommentID point at the content involved, when there is one. ReadAt is set
+// once the user read it.
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"size:64;index:idx_notification_user"`
+	ActorID   string     `json:"actor_id" gorm:"size:64"`
+	Type      string     `json:"type" gorm:"size:32"`
+	PostID    *uint      `json:"post_id"`
+	CommentID *uint      `json:"comment_id"`
+	ReadAt    *time.Time `json:"read_at" gorm:"index:idx_notification_user"`
+	CreatedAt time.Time  `json:"created_at"`
+	Actor     User       `json:"actor" gorm:"foreignkey:ActorID"`
+}
+
+// NotificationPreference turns one type of notification on or off for a
+// user. Types without a preference are on.
+type NotificationPreference struct {
+	ID      uint   `json:"-" gorm:"primaryKey"`
+	UserID  string `json:"-" gorm:"size:64;uniqueIndex:idx_notification_pref"`
+	Type    string `json:"type" gorm:"size:32;uniqueIndex:idx_notification_pref"`
+	Enabled bool   `json:"enabled"`
+}
@@ -0,0 +1,21 @@
+package structures
+
+import "time"
+
+// Reaction target types.
+const (
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+)
+
+// Reaction is a single emoji reaction left by a user on a post or a comment.
+// A user can leave at most one reaction of each type on the same target.
+type Reaction struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     string    `json:"user_id" gorm:"size:64;uniqueIndex:idx_reaction_unique"`
+	TargetType string    `json:"target_type" gorm:"size:16;uniqueIndex:idx_reaction_unique;index:idx_reaction_target"`
+	TargetID   uint      `json:"target_id" gorm:"uniqueIndex:idx_reaction_unique;index:idx_reaction_target"`
+	Type       string    `json:"type" gorm:"size:32;uniqueIndex:idx_reaction_unique"`
+	CreatedAt  time.Time `json:"created_at"`
+	User       User      `json:"user" gorm:"foreignkey:UserID"`
+}
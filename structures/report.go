@@ -0,0 +1,71 @@
+package structures
+
+import "time"
+
+// Report target types.
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+)
+
+// Report reason codes.
+const (
+	ReportSpam           = "spam"
+	ReportHarassment     = "harassment"
+	ReportHate           = "hate"
+	ReportViolence       = "violence"
+	ReportSexual         = "sexual"
+	ReportMisinformation = "misinformation"
+	ReportOther          = "other"
+)
+
+// Report statuses. Open and reviewing reports are waiting for a decision;
+// resolved ones led to action against the target, dismissed ones didn't.
+const (
+	ReportOpen      = "open"
+	ReportReviewing = "reviewing"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+// ReportHeldReason is the held reason of posts and comments hidden
+// automatically after too many reports.
+const ReportHeldReason = "hidden after reports"
+
+// Report is a user flagging a post, comment or user for moderators. A user
+// reports the same target at most once.
+type Report struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	ReporterID     string     `json:"reporter_id" gorm:"size:64;uniqueIndex:idx_report_unique"`
+	TargetType     string     `json:"target_type" gorm:"size:16;uniqueIndex:idx_report_unique;index:idx_report_target"`
+	TargetID       uint       `json:"target_id" gorm:"uniqueIndex:idx_report_unique;index:idx_report_target"`
+	Reason         string     `json:"reason" gorm:"size:32"`
+	Details        string     `json:"details" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"size:16;default:open;index"`
+	ResolvedBy     string     `json:"resolved_by,omitempty" gorm:"size:64"`
+	ResolutionNote string     `json:"resolution_note,omitempty" gorm:"type:text"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Reporter       User       `json:"reporter" gorm:"foreignkey:ReporterID"`
+}
+
+// ValidReportReason reports whether reason is one of the known reason
+// codes.
+func ValidReportReason(reason string) bool {
+	switch reason {
+	case ReportSpam, ReportHarassment, ReportHate, ReportViolence, ReportSexual, ReportMisinformation, ReportOther:
+		return true
+	}
+	return false
+}
+
+// ValidReportStatus reports whether status is one of the known report
+// statuses.
+func ValidReportStatus(status string) bool {
+	switch status {
+	case ReportOpen, ReportReviewing, ReportResolved, ReportDismissed:
+		return true
+	}
+	return false
+}
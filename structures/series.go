@@ -0,0 +1,42 @@
+package structures
+
+import "time"
+
+// Series groups posts of one author, such as the parts of a tutorial, in a
+// fixed reading order.
+type Series struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	UserID      string       `json:"user_id" gorm:"size:64;index"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	User        User         `json:"user" gorm:"foreignkey:UserID"`
+	Posts       []SeriesPost `json:"posts,omitempty" gorm:"foreignkey:SeriesID"`
+}
+
+// SeriesPost places a post at a position inside a series. A post belongs to
+// at most one series.
+type SeriesPost struct {
+	ID       uint `json:"id" gorm:"primaryKey"`
+	SeriesID uint `json:"series_id" gorm:"index"`
+	PostID   uint `json:"post_id" gorm:"uniqueIndex"`
+	Position int  `json:"position"`
+	Post     Blog `json:"post" gorm:"foreignkey:PostID"`
+}
+
+// SeriesNav tells the reader of a post where it sits in its series.
+type SeriesNav struct {
+	ID       uint        `json:"id"`
+	Title    string      `json:"title"`
+	Part     int         `json:"part"`
+	Parts    int         `json:"parts"`
+	Previous *SeriesLink `json:"previous"`
+	Next     *SeriesLink `json:"next"`
+}
+
+// SeriesLink points at a neighbouring post of a series.
+type SeriesLink struct {
+	ID    uint   `json:"id"`
+	Title string `json:"title"`
+}
@@ -0,0 +1,14 @@
+package structures
+
+// SpamToken counts how often a token appeared in content moderators marked
+// as spam and as ham. The row with the SpamDocs token counts the trained
+// documents themselves.
+type SpamToken struct {
+	Token string `json:"token" gorm:"primaryKey;size:64"`
+	Spam  int64  `json:"spam"`
+	Ham   int64  `json:"ham"`
+}
+
+// SpamDocs is the SpamToken row holding the number of trained documents. The
+// tokenizer never produces it.
+const SpamDocs = "*"
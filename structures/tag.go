@@ -0,0 +1,27 @@
+package structures
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Tag is a topic label that can be put on posts.
+type Tag struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name"`
+	Slug string `json:"slug" gorm:"size:64;uniqueIndex"`
+}
+
+var slugStrip = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// Slugify turns a tag name into its URL form, e.g. "Go Tips" -> "go-tips".
+// Letters and digits of any script are kept, so "Ünïcode Тег" becomes
+// "ünïcode-тег". Slugs are at most 64 characters.
+func Slugify(name string) string {
+	slug := slugStrip.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-")
+	slug = strings.Trim(slug, "-")
+	if runes := []rune(slug); len(runes) > 64 {
+		slug = strings.Trim(string(runes[:64]), "-")
+	}
+	return slug
+}
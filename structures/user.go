@@ -2,13 +2,47 @@ package structures
 
 import "golang.org/x/crypto/bcrypt"
 
+// User roles. Moderators can act on other users' content, admins can also
+// manage the whole site.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User is an account. FirstName, LastName and Email keep the JSON keys
+// clients have always seen.
 type User struct {
 	Id        uint   `json:"id"`
-	FirstName string `json:first_name`
-	LastName  string `json:last_name`
-	Email     string `json:email`
+	FirstName string `json:"FirstName"`
+	LastName  string `json:"LastName"`
+	Email     string `json:"Email"`
 	Password  []byte `json:"-"`
 	Phone     string `json:"phone"`
+	Role      string `json:"role" gorm:"size:16;default:user"`
+
+	// Handle is the unique name other users @mention this one by.
+	Handle string `json:"handle" gorm:"size:32;index"`
+
+	// Hidden is set when the profile was hidden after too many reports,
+	// until a moderator dismisses them.
+	Hidden bool `json:"hidden"`
+
+	// Counters kept up to date as users follow each other and write posts,
+	// so profiles don't count rows on every request. PostCount counts the
+	// posts the user owns, whatever their visibility.
+	FollowerCount  int64 `json:"follower_count" gorm:"default:0"`
+	FollowingCount int64 `json:"following_count" gorm:"default:0"`
+	PostCount      int64 `json:"post_count" gorm:"default:0"`
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
 }
 
 func (user *User) SetPassword(password string) {
@@ -19,3 +53,13 @@ func (user *User) SetPassword(password string) {
 func (user *User) ComparePassword(password string) error {
 	return bcrypt.CompareHashAndPassword(user.Password, []byte(password))
 }
+
+// IsAdmin reports whether the user can manage the whole site.
+func (user *User) IsAdmin() bool {
+	return user.Role == RoleAdmin
+}
+
+// IsModerator reports whether the user can moderate other users' content.
+func (user *User) IsModerator() bool {
+	return user.Role == RoleModerator || user.Role == RoleAdmin
+}
@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvInt reads an integer setting from the environment, falling back to def
+// when it is unset or malformed.
+func EnvInt(name string, def int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(name)))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// EnvString reads a string setting from the environment, falling back to def
+// when it is unset.
+func EnvString(name, def string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return def
+}
+
+// MaxCommentDepth is the deepest level comment replies nest to, read from
+// COMMENT_MAX_DEPTH (default 5). Top-level comments are at depth 0.
+func MaxCommentDepth() int {
+	if depth := EnvInt("COMMENT_MAX_DEPTH", 5); depth >= 0 {
+		return depth
+	}
+	return 5
+}
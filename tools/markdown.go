@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"bytes"
+	"html"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown renders post bodies. Raw HTML in the source is escaped since
+// goldmark runs without the unsafe renderer option.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// RenderMarkdown converts a Markdown post body to HTML.
+func RenderMarkdown(src string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+var (
+	htmlTag    = regexp.MustCompile(`<[^>]*>`)
+	whitespace = regexp.MustCompile(`\s+`)
+)
+
+// PlainText renders a Markdown body and strips the markup, leaving the
+// readable text on a single line.
+func PlainText(src string) string {
+	text := htmlTag.ReplaceAllString(RenderMarkdown(src), " ")
+	text = html.UnescapeString(text)
+	return strings.TrimSpace(whitespace.ReplaceAllString(text, " "))
+}
+
+// Truncate shortens text to at most n runes, cutting at a word boundary and
+// adding an ellipsis when something was cut off.
+func Truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > n/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// Summarize computes the excerpt, word count and estimated reading time in
+// minutes of a Markdown body. The excerpt length in runes is read from
+// EXCERPT_LENGTH (default 280) and the reading speed from WORDS_PER_MINUTE
+// (default 200).
+func Summarize(src string) (excerpt string, words, minutes int) {
+	words = len(strings.Fields(PlainText(src)))
+	if words > 0 {
+		wpm := EnvInt("WORDS_PER_MINUTE", 200)
+		if wpm < 1 {
+			wpm = 200
+		}
+		minutes = int(math.Ceil(float64(words) / float64(wpm)))
+	}
+	return Excerpt(src, EnvInt("EXCERPT_LENGTH", 280)), words, minutes
+}
+
+// Excerpt returns the opening prose of a Markdown body, at most n runes long.
+// Only paragraphs count: headings, code blocks and raw HTML are left out,
+// and inline markup is reduced to its text.
+func Excerpt(src string, n int) string {
+	source := []byte(src)
+	doc := markdown.Parser().Parse(text.NewReader(source))
+
+	var b strings.Builder
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node.Kind() {
+		case ast.KindParagraph:
+			if b.Len() > 0 {
+				b.WriteString(" ")
+			}
+			inlineText(&b, node, source)
+			if len([]rune(b.String())) >= n {
+				return ast.WalkStop, nil
+			}
+			return ast.WalkSkipChildren, nil
+		case ast.KindHeading, ast.KindCodeBlock, ast.KindFencedCodeBlock, ast.KindHTMLBlock:
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	excerpt := html.UnescapeString(b.String())
+	excerpt = strings.TrimSpace(whitespace.ReplaceAllString(excerpt, " "))
+	return Truncate(excerpt, n)
+}
+
+// inlineText writes the text of the inline nodes below node, keeping line
+// breaks as spaces and dropping raw HTML.
+func inlineText(b *strings.Builder, node ast.Node, source []byte) {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child := child.(type) {
+		case *ast.Text:
+			b.Write(child.Segment.Value(source))
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				b.WriteString(" ")
+			}
+		case *ast.String:
+			b.Write(child.Value)
+		case *ast.AutoLink:
+			b.Write(child.Label(source))
+		case *ast.RawHTML:
+		default:
+			inlineText(b, child, source)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package tools
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+)
+
+// UploadDir is where uploaded files are stored and served from.
+const UploadDir = "./uploads/"
+
+// MediaURL returns the public URL of an uploaded file. MEDIA_BASE_URL can be
+// set when uploads are served from another host.
+func MediaURL(fileName string) string {
+	return strings.TrimRight(os.Getenv("MEDIA_BASE_URL"), "/") + "/api/uploads/" + fileName
+}
+
+// ImageSize returns the dimensions of an image file, or zeros when the file
+// isn't an image we can decode.
+func ImageSize(path string) (int, int) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
@@ -0,0 +1,61 @@
+package tools
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// defaultReactions is used when REACTION_TYPES is not set in the environment.
+const defaultReactions = "like:👍,love:❤️,laugh:😂,wow:😮,sad:😢,angry:😠"
+
+// ReactionType is one entry of the configured reaction set.
+type ReactionType struct {
+	Name  string `json:"name"`
+	Emoji string `json:"emoji"`
+}
+
+var (
+	reactionsOnce sync.Once
+	reactionTypes []ReactionType
+	reactionIndex map[string]ReactionType
+)
+
+// loadReactions parses REACTION_TYPES, a comma separated list of name:emoji
+// pairs, e.g. "like:👍,love:❤️".
+func loadReactions() {
+	raw := os.Getenv("REACTION_TYPES")
+	if strings.TrimSpace(raw) == "" {
+		raw = defaultReactions
+	}
+	reactionIndex = map[string]ReactionType{}
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if name == "" {
+			continue
+		}
+		if _, ok := reactionIndex[name]; ok {
+			continue
+		}
+		rt := ReactionType{Name: name}
+		if len(parts) == 2 {
+			rt.Emoji = strings.TrimSpace(parts[1])
+		}
+		reactionTypes = append(reactionTypes, rt)
+		reactionIndex[name] = rt
+	}
+}
+
+// ReactionTypes returns the configured reaction set in declaration order.
+func ReactionTypes() []ReactionType {
+	reactionsOnce.Do(loadReactions)
+	return reactionTypes
+}
+
+// IsReactionType reports whether name is part of the configured reaction set.
+func IsReactionType(name string) bool {
+	reactionsOnce.Do(loadReactions)
+	_, ok := reactionIndex[name]
+	return ok
+}
@@ -0,0 +1,486 @@
+package wordpress
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aizeresalim/final/archive"
+	"github.com/aizeresalim/final/db"
+	"github.com/aizeresalim/final/mention"
+	"github.com/aizeresalim/final/structures"
+	"github.com/aizeresalim/final/tools"
+	"gorm.io/gorm"
+)
+
+// Kinds of imported items tracked in structures.ImportRecord. They are
+// prefixed so that they never collide with archive imports.
+const (
+	kindUser    = "wp-user"
+	kindPost    = "wp-post"
+	kindComment = "wp-comment"
+	kindMedia   = "wp-media"
+)
+
+// uploadsPath is where WordPress keeps attachments, relative to the site.
+const uploadsPath = "/wp-content/uploads/"
+
+// Options controls a WXR import.
+type Options struct {
+	// MediaDir is a local copy of wp-content/uploads. Attachments are copied
+	// from it; when empty, media URLs are left pointing at the old site.
+	MediaDir string
+	// FallbackUserID receives comments left without an email address. When
+	// zero such comments are skipped.
+	FallbackUserID uint
+	// Pages imports pages as posts instead of skipping them.
+	Pages bool
+}
+
+// Report summarises what an import did.
+type Report struct {
+	UsersCreated    int      `json:"users_created"`
+	PostsCreated    int      `json:"posts_created"`
+	PostsSkipped    int      `json:"posts_skipped"`
+	CommentsCreated int      `json:"comments_created"`
+	CommentsSkipped int      `json:"comments_skipped"`
+	MediaCopied     int      `json:"media_copied"`
+	Remapped        []string `json:"remapped"`
+	Skipped         []string `json:"skipped"`
+	Warnings        []string `json:"warnings"`
+}
+
+func (r *Report) remap(format string, args ...interface{}) {
+	r.Remapped = append(r.Remapped, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) skip(format string, args ...interface{}) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// importer holds the state of one import run.
+type importer struct {
+	origin  string
+	opts    Options
+	report  *Report
+	authors map[string]Author
+	users   map[string]uint
+	media   map[string]structures.Media
+	// attachments maps attachment post IDs to their upload URLs.
+	attachments map[string]string
+	// children maps post IDs to the attachments uploaded to them.
+	children map[string][]string
+}
+
+// Import writes the content of a WXR export into the database. Authors and
+// commenters are matched to local users by email or created without a
+// password, so they can't log in until one is set. Every imported item is
+// recorded so that importing the same file again skips it.
+func Import(export *Export, opts Options) (*Report, error) {
+	report := &Report{Remapped: []string{}, Skipped: []string{}, Warnings: []string{}}
+	origin := strings.TrimRight(export.BaseURL, "/")
+	if origin == "" {
+		origin = strings.TrimRight(export.Link, "/")
+	}
+	if origin == "" {
+		return report, fmt.Errorf("export has no site link")
+	}
+
+	im := &importer{
+		origin:      origin,
+		opts:        opts,
+		report:      report,
+		authors:     map[string]Author{},
+		users:       map[string]uint{},
+		media:       map[string]structures.Media{},
+		attachments: map[string]string{},
+		children:    map[string][]string{},
+	}
+	for _, author := range export.Authors {
+		im.authors[author.Login] = author
+	}
+	for _, item := range export.Items {
+		if item.Type == "attachment" && item.AttachmentURL != "" {
+			im.attachments[item.ID] = item.AttachmentURL
+			im.children[item.Parent] = append(im.children[item.Parent], item.AttachmentURL)
+		}
+	}
+
+	for _, item := range export.Items {
+		switch item.Type {
+		case "attachment", "nav_menu_item", "revision", "custom_css", "customize_changeset", "oembed_cache", "wp_block", "wp_global_styles", "wp_navigation", "wp_template", "wp_template_part":
+			continue
+		case "post":
+		case "page":
+			if !opts.Pages {
+				report.PostsSkipped++
+				report.skip("page %s %q: pages are not imported", item.ID, item.Title)
+				continue
+			}
+		default:
+			report.PostsSkipped++
+			report.skip("%s %s %q: unsupported post type", item.Type, item.ID, item.Title)
+			continue
+		}
+		if err := im.post(item); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// post imports one post and its comments.
+func (im *importer) post(item Item) error {
+	postID, done := archive.Imported("", im.origin, kindPost, item.ID)
+	if !done {
+		visibility, ok := im.visibility(item)
+		if !ok {
+			im.report.PostsSkipped++
+			return nil
+		}
+		userID, err := im.author(item.Creator)
+		if err != nil {
+			return err
+		}
+		if userID == 0 {
+			im.report.PostsSkipped++
+			im.report.skip("post %s %q: author %q has no email", item.ID, item.Title, item.Creator)
+			return nil
+		}
+		owner := strconv.Itoa(int(userID))
+
+		var inline []uint
+		rewrite := func(link string) string {
+			media, ok := im.copyMedia(link, owner)
+			if !ok {
+				return link
+			}
+			inline = append(inline, media.ID)
+			return tools.MediaURL(media.FileName)
+		}
+		body, err := ToMarkdown(item.Content, rewrite)
+		if err != nil {
+			im.report.warn("post %s %q: content could not be converted, kept as is: %v", item.ID, item.Title, err)
+			body = item.Content
+		}
+		for _, link := range im.children[item.ID] {
+			rewrite(link)
+		}
+
+		blog := structures.Blog{
+			Title:      strings.TrimSpace(item.Title),
+			Desc:       body,
+			UserID:     owner,
+			Visibility: visibility,
+			CreatedAt:  item.Published(),
+			UpdatedAt:  item.Modified(),
+		}
+		blog.Excerpt, blog.WordCount, blog.ReadingMinutes = tools.Summarize(blog.Desc)
+		if thumbnail := im.attachments[item.MetaValue("_thumbnail_id")]; thumbnail != "" {
+			if media, ok := im.copyMedia(thumbnail, owner); ok {
+				blog.CoverMediaID = &media.ID
+			}
+		}
+
+		err = db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit("Tags").Create(&blog).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&structures.User{}).Where("id = ?", blog.UserID).
+				UpdateColumn("post_count", gorm.Expr("post_count + 1")).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&blog).Association("Tags").Replace(archive.ResolveTags(tx, item.Tags())); err != nil {
+				return err
+			}
+			seen := map[uint]bool{}
+			for _, id := range inline {
+				if seen[id] {
+					continue
+				}
+				if err := tx.Create(&structures.PostMedia{PostID: blog.Id, MediaID: id, Position: len(seen)}).Error; err != nil {
+					return err
+				}
+				seen[id] = true
+			}
+			return archive.Record(tx, "", im.origin, kindPost, item.ID, blog.Id)
+		})
+		if err != nil {
+			return err
+		}
+		postID = blog.Id
+		im.report.PostsCreated++
+	}
+
+	// WordPress numbers comments in the order they were left, so parents
+	// are imported before their replies
+	comments := append([]Comment(nil), item.Comments...)
+	sort.SliceStable(comments, func(i, j int) bool {
+		a, _ := strconv.Atoi(comments[i].ID)
+		b, _ := strconv.Atoi(comments[j].ID)
+		return a < b
+	})
+	for _, comment := range comments {
+		if err := im.comment(item, postID, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visibility maps a WordPress status onto a post visibility. Content that
+// isn't published is kept private rather than lost.
+func (im *importer) visibility(item Item) (string, bool) {
+	switch item.Status {
+	case "publish":
+		if item.Password != "" {
+			im.report.remap("post %s %q: password protected -> private", item.ID, item.Title)
+			return structures.VisibilityPrivate, true
+		}
+		return structures.VisibilityPublic, true
+	case "private":
+		return structures.VisibilityPrivate, true
+	case "draft", "pending", "future":
+		im.report.remap("post %s %q: status %s -> private", item.ID, item.Title, item.Status)
+		return structures.VisibilityPrivate, true
+	}
+	im.report.skip("post %s %q: status %s", item.ID, item.Title, item.Status)
+	return "", false
+}
+
+// comment imports one approved comment of an imported post, under the
+// comment it replies to.
+func (im *importer) comment(item Item, postID uint, comment Comment) error {
+	source := item.ID + ":" + comment.ID
+	if _, ok := archive.Imported("", im.origin, kindComment, source); ok {
+		im.report.CommentsSkipped++
+		return nil
+	}
+	if comment.Type == "pingback" || comment.Type == "trackback" {
+		im.report.CommentsSkipped++
+		im.report.skip("comment %s on post %s: %s", comment.ID, item.ID, comment.Type)
+		return nil
+	}
+	if comment.Approved != "1" {
+		im.report.CommentsSkipped++
+		im.report.skip("comment %s on post %s: not approved (%s)", comment.ID, item.ID, comment.Approved)
+		return nil
+	}
+
+	userID, err := im.commenter(comment)
+	if err != nil {
+		return err
+	}
+	if userID == 0 {
+		im.report.CommentsSkipped++
+		im.report.skip("comment %s on post %s: %q left no email", comment.ID, item.ID, comment.Author)
+		return nil
+	}
+
+	content, err := ToMarkdown(comment.Content, nil)
+	if err != nil {
+		content = comment.Content
+	}
+	c := structures.Comment{
+		UserID:   strconv.Itoa(int(userID)),
+		PostID:   postID,
+		Content:  content,
+		DateTime: comment.Created(),
+	}
+	if parent, ok := im.replyParent(item, comment); ok {
+		c.ParentID = &parent.ID
+		c.Depth = parent.Depth + 1
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&c).Error; err != nil {
+			return err
+		}
+		if c.ParentID != nil {
+			if err := tx.Model(&structures.Comment{}).Where("id = ?", *c.ParentID).
+				UpdateColumn("reply_count", gorm.Expr("reply_count + 1")).Error; err != nil {
+				return err
+			}
+		}
+		return archive.Record(tx, "", im.origin, kindComment, source, c.ID)
+	})
+	if err != nil {
+		return err
+	}
+	im.report.CommentsCreated++
+	return nil
+}
+
+// replyParent finds the imported comment a reply hangs under. Replies whose
+// parent wasn't imported go to the top level, and replies nested deeper
+// than tools.MaxCommentDepth hang under their deepest allowed ancestor.
+func (im *importer) replyParent(item Item, comment Comment) (structures.Comment, bool) {
+	if comment.Parent == "" || comment.Parent == "0" {
+		return structures.Comment{}, false
+	}
+	parent, ok := archive.ReplyParent("", im.origin, kindComment, item.ID+":"+comment.Parent)
+	if !ok {
+		im.report.remap("comment %s on post %s: parent %s was not imported -> top level", comment.ID, item.ID, comment.Parent)
+	}
+	return parent, ok
+}
+
+// author resolves a post author login to a local user.
+func (im *importer) author(login string) (uint, error) {
+	author, ok := im.authors[login]
+	if !ok {
+		author = Author{Login: login, DisplayName: login}
+	}
+	first, last := author.FirstName, author.LastName
+	if first == "" && last == "" {
+		first, last = splitName(author.DisplayName)
+	}
+	return im.user(author.Email, first, last, "author "+login)
+}
+
+// commenter resolves a comment author to a local user by email, falling
+// back to Options.FallbackUserID for anonymous comments.
+func (im *importer) commenter(comment Comment) (uint, error) {
+	if strings.TrimSpace(comment.AuthorEmail) == "" {
+		if im.opts.FallbackUserID != 0 {
+			im.report.remap("comment %s by %q -> user %d (fallback)", comment.ID, comment.Author, im.opts.FallbackUserID)
+		}
+		return im.opts.FallbackUserID, nil
+	}
+	first, last := splitName(comment.Author)
+	return im.user(comment.AuthorEmail, first, last, "commenter "+comment.Author)
+}
+
+// user finds the local account with the given email or creates one.
+func (im *importer) user(email, first, last, label string) (uint, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return 0, nil
+	}
+	if id, ok := im.users[email]; ok {
+		return id, nil
+	}
+
+	var user structures.User
+	err := db.DB.Where("email = ?", email).First(&user).Error
+	switch {
+	case err == nil:
+		if _, created := archive.Imported("", im.origin, kindUser, email); !created {
+			im.report.remap("%s <%s> -> user %d (same email)", label, email, user.Id)
+		}
+	case err == gorm.ErrRecordNotFound:
+		user = structures.User{FirstName: first, LastName: last, Email: email}
+		user.Handle = mention.NewHandle(user)
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			return archive.Record(tx, "", im.origin, kindUser, email, user.Id)
+		})
+		if err != nil {
+			return 0, err
+		}
+		im.report.UsersCreated++
+		im.report.remap("%s <%s> -> user %d (created)", label, email, user.Id)
+	default:
+		return 0, err
+	}
+	im.users[email] = user.Id
+	return user.Id, nil
+}
+
+// copyMedia copies an attachment from Options.MediaDir into the upload
+// directory and records it as media of the user. Links outside the uploads
+// of the old site are ignored.
+func (im *importer) copyMedia(link, userID string) (structures.Media, bool) {
+	rel := uploadPath(link)
+	if rel == "" || im.opts.MediaDir == "" {
+		return structures.Media{}, false
+	}
+	if media, ok := im.media[rel]; ok {
+		return media, true
+	}
+	var media structures.Media
+	if id, ok := archive.Imported("", im.origin, kindMedia, rel); ok {
+		if err := db.DB.Where("id = ?", id).First(&media).Error; err == nil {
+			im.media[rel] = media
+			return media, true
+		}
+	}
+
+	src, err := os.Open(filepath.Join(im.opts.MediaDir, filepath.FromSlash(rel)))
+	if err != nil {
+		im.report.warn("media %s is missing from %s", rel, im.opts.MediaDir)
+		return media, false
+	}
+	defer src.Close()
+
+	media = structures.Media{
+		UserID:       userID,
+		FileName:     "wp-" + strings.ReplaceAll(rel, "/", "-"),
+		OriginalName: path.Base(rel),
+	}
+	dst, err := os.Create(tools.UploadDir + media.FileName)
+	if err != nil {
+		im.report.warn("media %s could not be copied: %v", rel, err)
+		return media, false
+	}
+	media.Size, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		im.report.warn("media %s could not be copied: %v", rel, err)
+		return media, false
+	}
+	media.Width, media.Height = tools.ImageSize(tools.UploadDir + media.FileName)
+
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&media).Error; err != nil {
+			return err
+		}
+		return archive.Record(tx, "", im.origin, kindMedia, rel, media.ID)
+	})
+	if err != nil {
+		im.report.warn("media %s could not be recorded: %v", rel, err)
+		return media, false
+	}
+	im.media[rel] = media
+	im.report.MediaCopied++
+	return media, true
+}
+
+// uploadPath returns the path of a link below wp-content/uploads, or "" when
+// the link points elsewhere.
+func uploadPath(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	i := strings.Index(u.Path, uploadsPath)
+	if i < 0 {
+		return ""
+	}
+	rel := path.Clean(u.Path[i+len(uploadsPath):])
+	if rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return rel
+}
+
+func splitName(name string) (string, string) {
+	parts := strings.Fields(name)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return parts[0], strings.Join(parts[1:], " ")
+}
@@ -0,0 +1,228 @@
+package wordpress
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n`)
+	extraBlank     = regexp.MustCompile(`\n([ \t]*\n){2,}`)
+	shortcode      = regexp.MustCompile(`\[/?(caption|embed|gallery|audio|video)[^\]]*\]`)
+	markdownEscape = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+)
+
+// ToMarkdown converts post HTML to Markdown. WordPress stores most posts
+// without <p> tags and relies on blank lines, so blank lines in text are kept
+// as paragraph breaks. rewrite, when set, maps link and image URLs.
+func ToMarkdown(content string, rewrite func(string) string) (string, error) {
+	if rewrite == nil {
+		rewrite = func(url string) string { return url }
+	}
+	content = shortcode.ReplaceAllString(content, "")
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", err
+	}
+	c := converter{rewrite: rewrite}
+	var b strings.Builder
+	for _, n := range nodes {
+		c.node(&b, n)
+	}
+	return tidy(b.String()), nil
+}
+
+type converter struct {
+	rewrite func(string) string
+}
+
+func (c converter) children(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.node(&b, child)
+	}
+	return b.String()
+}
+
+func (c converter) node(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(inlineText(n.Data))
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		b.WriteString(c.children(n))
+		return
+	default:
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Iframe, atom.Noscript:
+	case atom.P, atom.Div, atom.Section, atom.Article, atom.Figure, atom.Figcaption, atom.Table, atom.Tr:
+		block(b, tidy(c.children(n)))
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		block(b, strings.Repeat("#", level)+" "+oneLine(c.children(n)))
+	case atom.Br:
+		b.WriteString("  \n")
+	case atom.Hr:
+		block(b, "---")
+	case atom.Strong, atom.B:
+		b.WriteString(wrap(c.children(n), "**"))
+	case atom.Em, atom.I:
+		b.WriteString(wrap(c.children(n), "_"))
+	case atom.Del, atom.S, atom.Strike:
+		b.WriteString(wrap(c.children(n), "~~"))
+	case atom.Code, atom.Kbd:
+		if text := textContent(n); strings.TrimSpace(text) != "" {
+			fence := "`"
+			if strings.Contains(text, "`") {
+				fence = "`` "
+			}
+			b.WriteString(fence + text + reverse(fence))
+		}
+	case atom.Pre:
+		lang := ""
+		if code := n.FirstChild; code != nil && code.DataAtom == atom.Code {
+			lang = strings.TrimPrefix(attr(code, "class"), "language-")
+		}
+		block(b, "```"+lang+"\n"+strings.TrimRight(textContent(n), "\n")+"\n```")
+	case atom.A:
+		text := oneLine(c.children(n))
+		href := c.rewrite(attr(n, "href"))
+		switch {
+		case href == "":
+			b.WriteString(text)
+		case text == "":
+			b.WriteString("<" + href + ">")
+		default:
+			b.WriteString("[" + text + "](" + href + ")")
+		}
+	case atom.Img:
+		if src := c.rewrite(attr(n, "src")); src != "" {
+			b.WriteString("![" + markdownEscape.Replace(attr(n, "alt")) + "](" + src + ")")
+		}
+	case atom.Blockquote:
+		block(b, prefixLines(tidy(c.children(n)), "> ", "> "))
+	case atom.Ul, atom.Ol:
+		block(b, c.list(n))
+	case atom.Td, atom.Th:
+		b.WriteString(oneLine(c.children(n)) + " ")
+	default:
+		b.WriteString(c.children(n))
+	}
+}
+
+// list renders the items of a ul or ol, indenting continuation lines so
+// that nested blocks stay inside their item.
+func (c converter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		item := tidy(c.children(child))
+		items = append(items, prefixLines(item, marker, strings.Repeat(" ", len(marker))))
+	}
+	return strings.Join(items, "\n")
+}
+
+func block(b *strings.Builder, s string) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	b.WriteString("\n\n" + s + "\n\n")
+}
+
+// inlineText collapses whitespace the way a browser would, except that blank
+// lines stay paragraph breaks.
+func inlineText(s string) string {
+	paragraphs := paragraphBreak.Split(s, -1)
+	for i, p := range paragraphs {
+		text := strings.Join(strings.Fields(p), " ")
+		if text != "" && strings.TrimLeft(p, " \t\r\n") != p {
+			text = " " + text
+		}
+		if text != "" && strings.TrimRight(p, " \t\r\n") != p {
+			text += " "
+		}
+		if text == "" && p != "" {
+			text = " "
+		}
+		paragraphs[i] = markdownEscape.Replace(text)
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func wrap(s, marker string) string {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return s
+	}
+	// Keep surrounding spaces outside the markers so emphasis still parses
+	lead := s[:len(s)-len(strings.TrimLeft(s, " "))]
+	trail := s[len(strings.TrimRight(s, " ")):]
+	return lead + marker + text + marker + trail
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line == "" && rest != "> ":
+		default:
+			lines[i] = rest + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tidy drops runs of blank lines and surrounding whitespace.
+func tidy(s string) string {
+	return strings.TrimSpace(extraBlank.ReplaceAllString(s, "\n\n"))
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
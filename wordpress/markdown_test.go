@@ -0,0 +1,66 @@
+package wordpress
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"bare paragraphs", "First line\nstill first.\n\nSecond.", "First line still first.\n\nSecond."},
+		{"paragraph tags", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"headings", "<h2>Title  here</h2><p>Body</p>", "## Title here\n\nBody"},
+		{"emphasis", "<p>a <strong>bold</strong> and <em> soft </em> word</p>", "a **bold** and  _soft_  word"},
+		{"strikethrough", "<del>gone</del>", "~~gone~~"},
+		{"escaping", "<p>2*3 = my_var [x]</p>", `2\*3 = my\_var \[x\]`},
+		{"inline code", "<p>run <code>go test</code> and <code>a`b</code></p>", "run `go test` and `` a`b ``"},
+		{"code block", "<pre><code class=\"language-go\">x := 1\n\ny := 2\n</code></pre>", "```go\nx := 1\n\ny := 2\n```"},
+		{"link", `<a href="https://example.com/a">the  site</a>`, "[the site](https://example.com/a)"},
+		{"bare link", `<a href="https://example.com/a"></a>`, "<https://example.com/a>"},
+		{"image", `<img src="https://example.com/i.png" alt="a_b">`, `![a\_b](https://example.com/i.png)`},
+		{"line break", "one<br>two", "one  \ntwo"},
+		{"rule", "<p>a</p><hr><p>b</p>", "a\n\n---\n\nb"},
+		{"blockquote", "<blockquote><p>one</p><p>two</p></blockquote>", "> one\n> \n> two"},
+		{"unordered list", "<ul><li>one</li><li>two</li></ul>", "- one\n- two"},
+		{"ordered list", "<ol><li>one</li><li>two</li></ol>", "1. one\n2. two"},
+		{"nested list", "<ul><li>one<ul><li>inner</li></ul></li></ul>", "- one\n\n  - inner"},
+		{"shortcodes", `[caption id="1"]<img src="/a.png" alt="x">[/caption]`, "![x](/a.png)"},
+		{"scripts dropped", "<p>kept</p><script>alert(1)</script><style>p{}</style>", "kept"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ToMarkdown(test.html, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("ToMarkdown(%q) =\n%q\nwant\n%q", test.html, got, test.want)
+			}
+		})
+	}
+}
+
+func TestToMarkdownRewrite(t *testing.T) {
+	var seen []string
+	rewrite := func(link string) string {
+		seen = append(seen, link)
+		if strings.Contains(link, "/wp-content/uploads/") {
+			return "/uploads/" + link[strings.LastIndex(link, "/")+1:]
+		}
+		return link
+	}
+	got, err := ToMarkdown(`<a href="https://old.example/about">About</a> <img src="https://old.example/wp-content/uploads/2020/01/cat.jpg" alt="cat">`, rewrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[About](https://old.example/about) ![cat](/uploads/cat.jpg)"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if len(seen) != 2 {
+		t.Fatalf("rewrite called with %q", seen)
+	}
+}
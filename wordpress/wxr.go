@@ -0,0 +1,144 @@
+// Package wordpress imports a WordPress WXR export file: authors, posts,
+// comments, tags and attachments.
+package wordpress
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"time"
+)
+
+// Export is the part of a WXR file the importer uses.
+type Export struct {
+	Title   string   `xml:"channel>title"`
+	Link    string   `xml:"channel>link"`
+	BaseURL string   `xml:"channel>base_site_url"`
+	Authors []Author `xml:"channel>author"`
+	Items   []Item   `xml:"channel>item"`
+}
+
+// Author is a wp:author entry.
+type Author struct {
+	ID          string `xml:"author_id"`
+	Login       string `xml:"author_login"`
+	Email       string `xml:"author_email"`
+	DisplayName string `xml:"author_display_name"`
+	FirstName   string `xml:"author_first_name"`
+	LastName    string `xml:"author_last_name"`
+}
+
+// Item is a post, page or attachment.
+type Item struct {
+	Title         string     `xml:"title"`
+	Link          string     `xml:"link"`
+	Creator       string     `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Content       string     `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	ID            string     `xml:"post_id"`
+	DateGMT       string     `xml:"post_date_gmt"`
+	Date          string     `xml:"post_date"`
+	ModifiedGMT   string     `xml:"post_modified_gmt"`
+	Status        string     `xml:"status"`
+	Type          string     `xml:"post_type"`
+	Parent        string     `xml:"post_parent"`
+	Password      string     `xml:"post_password"`
+	AttachmentURL string     `xml:"attachment_url"`
+	Categories    []Category `xml:"category"`
+	Meta          []Meta     `xml:"postmeta"`
+	Comments      []Comment  `xml:"comment"`
+}
+
+// Category is a category or tag assigned to an item.
+type Category struct {
+	Domain   string `xml:"domain,attr"`
+	Nicename string `xml:"nicename,attr"`
+	Name     string `xml:",chardata"`
+}
+
+// Meta is a wp:postmeta key/value pair.
+type Meta struct {
+	Key   string `xml:"meta_key"`
+	Value string `xml:"meta_value"`
+}
+
+// Comment is a wp:comment entry of an item.
+type Comment struct {
+	ID          string `xml:"comment_id"`
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	DateGMT     string `xml:"comment_date_gmt"`
+	Date        string `xml:"comment_date"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+	Parent      string `xml:"comment_parent"`
+	UserID      string `xml:"comment_user_id"`
+}
+
+// Parse reads a WXR document. Elements in the wp: namespace are matched by
+// local name since the namespace URI changes between WXR versions.
+func Parse(r io.Reader) (*Export, error) {
+	var export Export
+	dec := xml.NewDecoder(r)
+	dec.Strict = false
+	if err := dec.Decode(&export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// MetaValue returns the value of a post meta key.
+func (i Item) MetaValue(key string) string {
+	for _, m := range i.Meta {
+		if m.Key == key {
+			return m.Value
+		}
+	}
+	return ""
+}
+
+// Published returns the publication time of the item.
+func (i Item) Published() time.Time {
+	return parseTime(i.DateGMT, i.Date)
+}
+
+// Modified returns the last modification time, falling back to the
+// publication time.
+func (i Item) Modified() time.Time {
+	if t := parseTime(i.ModifiedGMT, ""); !t.IsZero() {
+		return t
+	}
+	return i.Published()
+}
+
+// Tags returns the names of the tags and categories of the item. Both become
+// tags since this blog has no separate categories.
+func (i Item) Tags() []string {
+	var tags []string
+	for _, c := range i.Categories {
+		if c.Domain == "post_tag" || c.Domain == "category" {
+			name := strings.TrimSpace(c.Name)
+			if name != "" && !strings.EqualFold(name, "Uncategorized") {
+				tags = append(tags, name)
+			}
+		}
+	}
+	return tags
+}
+
+// Created returns the time the comment was written.
+func (c Comment) Created() time.Time {
+	return parseTime(c.DateGMT, c.Date)
+}
+
+// parseTime parses WordPress "2006-01-02 15:04:05" dates. The GMT value is
+// preferred; WordPress writes 0000-00-00 00:00:00 for drafts.
+func parseTime(gmt, local string) time.Time {
+	if t, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(gmt)); err == nil && t.Year() > 1 {
+		return t
+	}
+	if t, err := time.Parse("2006-01-02 15:04:05", strings.TrimSpace(local)); err == nil && t.Year() > 1 {
+		return t
+	}
+	return time.Time{}
+}